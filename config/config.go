@@ -15,17 +15,83 @@ type Config struct {
 	LatencyBucketName         *string
 	GatewayBucketName         *string
 	DurabilityBucketName      *string
+	NormalizeBucketNames      *bool
 	Interval                  *time.Duration
+	Once                      *bool
 	Addr                      *string
+	LogFormat                 *string
+	LogLevel                  *string
 	AccessKey                 *string
 	SecretKey                 *string
+	SessionToken              *string
+	CredentialsProvider       *string
+	CredentialsFile           *string
+	CredentialsProfile        *string
+	Secure                    *bool
+	CACert                    *string
+	InsecureSkipVerify        *bool
+	DialTimeout               *time.Duration
+	TLSHandshakeTimeout       *time.Duration
+	MaxIdleConnsPerHost       *int
+	DisableKeepAlives         *bool
+	Backend                   *string
+	Region                    *string
+	BucketLookup              *string
+	RegionHeader              *string
 	ProbeRatePerMin           *int
 	DurabilityProbeRatePerMin *int
 	LatencyItemSize           *int
+	LatencyItemSizes          *string
 	DurabilityItemSize        *int
 	DurabilityItemTotal       *int
+	DurabilitySampleSize      *int
+	DurabilityReadyThreshold  *float64
 	DurabilityTimeout         *time.Duration
 	LatencyTimeout            *time.Duration
+	LatencyMetric             *string
+	LatencyHistogramBuckets   *string
+	ListObjectsMaxKeys        *int
+	RangeGetSize              *int
+	LifecycleExpirationDays   *int
+	ObjectNameLength          *int
+	ObjectNameCharset         *string
+	VersioningProbe           *bool
+	VersioningBucketName      *string
+	ObjectLockProbe           *bool
+	ObjectLockBucketName      *string
+	LargeStatProbe            *bool
+	LargeStatObject           *string
+	LargeStatSize             *int
+	LargeStatSamples          *int
+	LargeStatRatio            *float64
+	MultipartProbeRatePerMin  *int
+	MultipartPartSize         *int
+	MultipartParts            *int
+	OverwriteProbeRatePerMin  *int
+	ReadAfterWriteRatePerMin  *int
+	ReadAfterWriteWindow      *time.Duration
+	ProbeJitter               *float64
+	OverwriteCount            *int
+	UsageFetcher              *string
+	NotificationSink          *string
+	NotificationTimeout       *time.Duration
+	SendContentMD5            *bool
+	ContentMD5Probe           *bool
+	CopyProbe                 *bool
+	TaggingProbe              *bool
+	RemoveObjectsProbe        *bool
+	BucketProbe               *bool
+	RemoveObjectsCount        *int
+	PresignProbe              *bool
+	PreflightProbe            *bool
+	PreflightOrigin           *string
+	EdgeLagTimeout            *time.Duration
+	SeedMinDelay              *time.Duration
+	SeedMaxDelay              *time.Duration
+	SeedRetryMinDelay         *time.Duration
+	SeedRetryMaxDelay         *time.Duration
+	SeedMaxRetries            *int
+	SeedWorkers               *int
 }
 
 // ParseConfig parse the configuration and create a Config struct
@@ -36,20 +102,86 @@ func ParseConfig() Config {
 		GatewayTag: flag.String("gateway-tag", "s3-gateway", "Tag to search on consul"),
 		EndpointSuffix: flag.String("suffix", ".service.{dc}.foo.bar",
 			"Suffix to add after the consul service name to create a valid domain name"),
-		LatencyBucketName:         flag.String("latency-bucket", "monitoring-latency", "Bucket used for the latency monitoring probe (will read and write)"),
+		LatencyBucketName:         flag.String("latency-bucket", "monitoring-latency", "Bucket used for the latency monitoring probe (will read and write), a comma separated list probes each bucket"),
 		GatewayBucketName:         flag.String("gateway-bucket", "monitoring-gateway", "Bucket used for the gateway latency monitoring probe (will read and write)"),
 		DurabilityBucketName:      flag.String("durability-bucket", "monitoring-durability", "Bucket used for the durability monitoring probe (will read and write)"),
+		NormalizeBucketNames:      flag.Bool("normalize-bucket-names", false, "Trim and lowercase the bucket names before using them (for endpoints normalizing bucket names)"),
 		Interval:                  flag.Duration("interval", 600*time.Second, "How often consul is polled to discover new S3 endoints"),
+		Once:                      flag.Bool("once", false, "Run a single probe cycle on every endpoint then exit, with a nonzero status if any check failed"),
+		DurabilityReadyThreshold:  flag.Float64("durability-ready-threshold", 1, "Fraction of the durability items that must be seeded before reporting durability"),
 		DurabilityTimeout:         flag.Duration("durablity-timeout", 60*time.Second, "Timeout duration of the durability check"),
-		LatencyTimeout:            flag.Duration("latency-timeout", 5*time.Second, "Timeout duration of the latency check"),
+		LatencyTimeout:            flag.Duration("latency-timeout", 5*time.Second, "Timeout of every operation performed by the checks, operations exceeding it are recorded as failed"),
+		LatencyMetric:             flag.String("latency-metric", "both", "Latency metric exposed: summary (s3_latency_seconds), histogram (s3_latency_histogram_seconds, can be aggregated across probes) or both"),
+		LatencyHistogramBuckets:   flag.String("latency-histogram-buckets", "", "Comma separated upper bounds (in seconds) of the latency histogram buckets (defaults to 1ms up to 10s)"),
+		RangeGetSize:              flag.Int("range-get-size", 0, "Number of bytes read from the start of the latency objects by the range_get latency check (0 disables it)"),
+		ListObjectsMaxKeys:        flag.Int("list-objects-max-keys", 0, "Number of keys of the durability bucket listed by the list_objects latency check (0 disables it)"),
+		LifecycleExpirationDays:   flag.Int("lifecycle-expiration-days", 1, "Days after which objects left on the latency and gateway buckets expire (0 disables the lifecycle rule)"),
 		Addr:                      flag.String("listen-address", ":8080", "The address to listen on for HTTP requests."),
+		LogFormat:                 flag.String("log-format", "text", "Format of the logs: text or json"),
+		LogLevel:                  flag.String("log-level", "info", "Minimum level of the logs: debug, info, warn or error"),
 		AccessKey:                 flag.String("s3-access-key", "", "User key of the S3 endpoint"),
 		SecretKey:                 flag.String("s3-secret-key", "", "Access key of the S3 endpoint"),
-		ProbeRatePerMin:           flag.Int("probe-rate", 120, "Rate of probing per minute (how many checks are done in a minute)"),
-		DurabilityProbeRatePerMin: flag.Int("durability-probe-rate", 1, "Rate of probing per minute (how many checks are done in a minute)"),
+		SessionToken:              flag.String("s3-session-token", "", "Session token of the static credentials"),
+		CredentialsProvider:       flag.String("s3-credentials", "static", "Credentials provider: static (-s3-access-key/-s3-secret-key), env (AWS_ACCESS_KEY_ID...), file (AWS credentials file) or iam (EC2/ECS role, refreshed before expiry)"),
+		CredentialsFile:           flag.String("s3-credentials-file", "", "AWS credentials file of the file provider (defaults to ~/.aws/credentials)"),
+		CredentialsProfile:        flag.String("s3-credentials-profile", "", "Profile of the AWS credentials file (defaults to default)"),
+		Region:                    flag.String("region", "", "Region of the S3 endpoints, used to sign the requests and to create the buckets (empty for the default region, region mismatches are not checked when empty)"),
+		BucketLookup:              flag.String("bucket-lookup", "auto", "Bucket addressing style: path (endpoint/bucket, e.g. for MinIO or Ceph RGW), dns (bucket.endpoint) or auto"),
+		RegionHeader:              flag.String("region-header", "X-Amz-Bucket-Region", "Response header reporting the region (or vendor zone) that served the request"),
+		Secure:                    flag.Bool("s3-secure", false, "Use HTTPS for the S3 endpoints given without http:// or https:// scheme"),
+		CACert:                    flag.String("s3-ca-cert", "", "PEM file of the CA to trust in addition to the system ones (for self-signed endpoint certificates)"),
+		InsecureSkipVerify:        flag.Bool("s3-insecure-skip-verify", false, "Skip the verification of the endpoint certificates (staging only)"),
+		DialTimeout:               flag.Duration("s3-dial-timeout", 30*time.Second, "Timeout of the connections to the S3 endpoints"),
+		TLSHandshakeTimeout:       flag.Duration("s3-tls-handshake-timeout", 10*time.Second, "Timeout of the TLS handshakes with the S3 endpoints"),
+		MaxIdleConnsPerHost:       flag.Int("s3-max-idle-conns-per-host", 16, "Number of idle connections kept open to each S3 endpoint"),
+		DisableKeepAlives:         flag.Bool("s3-disable-keep-alives", false, "Open a new connection for every request, so the latencies include the connection and TLS handshake"),
+		Backend:                   flag.String("backend", "s3", "Backend probed: s3, or memory to run a single probe against an in-memory S3 for local testing"),
+		ProbeRatePerMin:           flag.Int("probe-rate", 120, "Rate of probing per minute (how many checks are done in a minute, at most 60000)"),
+		DurabilityProbeRatePerMin: flag.Int("durability-probe-rate", 1, "Rate of durability probing per minute (0 disables the durability probe)"),
 		DurabilityItemSize:        flag.Int("durability-item-size", 1024*10, "Size of the item to insert into S3 for durability testing"),
 		LatencyItemSize:           flag.Int("latency-item-size", 1024*10, "Size of the item to insert into S3 for latency testing"),
+		LatencyItemSizes:          flag.String("latency-item-sizes", "", "Comma separated sizes of the items written by the latency probe, each size is a label of the latency metrics (defaults to latency-item-size)"),
 		DurabilityItemTotal:       flag.Int("item-total", 100000, "Total number of items to write into S3 for durability testing"),
+		DurabilitySampleSize:      flag.Int("durability-sample-size", 10, "Number of durability items read on each durability check (0 only counts the items)"),
+		ObjectNameLength:          flag.Int("object-name-length", 40, "Length (in characters) of the object names used by the latency probe"),
+		ObjectNameCharset:         flag.String("object-name-charset", "hex", "Charset of the object names used by the latency probe (hex, alphanumeric or nasty to stress URL encoding)"),
+		VersioningProbe:           flag.Bool("versioning-probe", false, "Enable the versioned delete probe (the endpoint must support bucket versioning)"),
+		VersioningBucketName:      flag.String("versioning-bucket", "monitoring-versioning", "Bucket used for the versioned delete probe (will read and write)"),
+		ObjectLockProbe:           flag.Bool("object-lock-probe", false, "Enable the governance-mode Object Lock probe (skipped on endpoints without Object Lock support)"),
+		ObjectLockBucketName:      flag.String("object-lock-bucket", "monitoring-object-lock", "Bucket used for the Object Lock probe (will read and write)"),
+		LargeStatProbe:            flag.Bool("large-stat-probe", false, "Enable the probe comparing StatObject latency on a large object and on a small object"),
+		LargeStatObject:           flag.String("large-stat-object", "monitoring-stat-large-object", "Object of the latency bucket used as large object by the StatObject probe (written when missing)"),
+		LargeStatSize:             flag.Int("large-stat-size", 16*1024*1024, "Size of the large object of the StatObject probe"),
+		LargeStatSamples:          flag.Int("large-stat-samples", 5, "Number of StatObject on each object per check, their median latencies are compared"),
+		LargeStatRatio:            flag.Float64("large-stat-ratio", 5, "Latency ratio between large and small objects StatObject above which HEAD is considered as reading the body"),
+		MultipartProbeRatePerMin:  flag.Int("multipart-probe-rate", 0, "Rate of multipart upload probing per minute (0 disables the multipart probe)"),
+		MultipartPartSize:         flag.Int("multipart-part-size", 5*1024*1024, "Size of each part uploaded by the multipart probe (S3 requires at least 5MiB except for the last part)"),
+		MultipartParts:            flag.Int("multipart-parts", 2, "Number of parts uploaded by the multipart probe"),
+		OverwriteProbeRatePerMin:  flag.Int("overwrite-probe-rate", 0, "Rate of overwrite probing per minute (0 disables the overwrite probe)"),
+		ReadAfterWriteRatePerMin:  flag.Int("read-after-write-probe-rate", 0, "Rate of read-after-write consistency probing per minute (0 disables the read-after-write probe)"),
+		ReadAfterWriteWindow:      flag.Duration("read-after-write-window", 5*time.Second, "Time a written object has to become readable before being counted as inconsistent"),
+		ProbeJitter:               flag.Float64("probe-jitter", 0.1, "Ratio by which every probing interval is randomly shortened or lengthened (0 disables the jitter)"),
+		OverwriteCount:            flag.Int("overwrite-count", 10, "Number of overwrites of the same key done by the overwrite probe"),
+		UsageFetcher:              flag.String("usage-fetcher", "", "Name of the fetcher used to report the usage of the probe buckets (e.g. listing), empty to disable"),
+		NotificationSink:          flag.String("notification-sink", "", "Name of the sink used to check event notifications delivery (e.g. webhook), empty to disable"),
+		NotificationTimeout:       flag.Duration("notification-timeout", 10*time.Second, "How long to wait for an event notification to be delivered"),
+		SendContentMD5:            flag.Bool("send-content-md5", false, "Send the Content-MD5 header on latency uploads"),
+		ContentMD5Probe:           flag.Bool("content-md5-probe", false, "Enable the probe uploading objects with a wrong Content-MD5 to check that the endpoint rejects them"),
+		CopyProbe:                 flag.Bool("copy-probe", false, "Enable the probe copying an object server side (operation copy_object)"),
+		BucketProbe:               flag.Bool("bucket-probe", false, "Enable the probe creating and removing a temporary bucket (operations make_bucket and remove_bucket, the credentials must allow creating buckets)"),
+		RemoveObjectsProbe:        flag.Bool("remove-objects-probe", false, "Enable the probe removing a batch of objects with a multi-object delete (operation remove_objects)"),
+		RemoveObjectsCount:        flag.Int("remove-objects-count", 10, "Number of objects written then removed in one multi-object delete by the remove objects probe"),
+		TaggingProbe:              flag.Bool("tagging-probe", false, "Enable the probe writing and reading back object tags (operations put_tagging and get_tagging)"),
+		PresignProbe:              flag.Bool("presign-probe", false, "Enable the probe fetching an object through a presigned URL with a plain HTTP client"),
+		PreflightProbe:            flag.Bool("preflight-probe", false, "Enable the CORS preflight (OPTIONS) probe on the latency bucket (CORS must be configured on the bucket)"),
+		PreflightOrigin:           flag.String("preflight-origin", "https://example.com", "Origin sent by the CORS preflight probe"),
+		EdgeLagTimeout:            flag.Duration("edge-lag-timeout", 10*time.Second, "How long to wait for an object written on the origin to be visible from the edge endpoint"),
+		SeedMinDelay:              flag.Duration("seed-min-delay", 100*time.Millisecond, "Delay between durability seeding writes once the endpoint starts throttling"),
+		SeedMaxDelay:              flag.Duration("seed-max-delay", 30*time.Second, "Maximum delay between durability seeding writes while the endpoint is throttling"),
+		SeedRetryMinDelay:         flag.Duration("seed-retry-min-delay", 1*time.Second, "Delay before retrying a durability seeding write that failed, doubled on each retry"),
+		SeedRetryMaxDelay:         flag.Duration("seed-retry-max-delay", 60*time.Second, "Maximum delay between the retries of a durability seeding write"),
+		SeedMaxRetries:            flag.Int("seed-max-retries", 10, "Number of retries of a durability seeding write before giving up on the seeding"),
+		SeedWorkers:               flag.Int("seed-workers", 1, "Number of concurrent writers seeding the durability bucket"),
 	}
 
 	flag.Parse()
@@ -60,16 +192,82 @@ func GetTestConfig() Config {
 	dummyValue := ""
 	accessKey := GetEnv("S3_ACCESS_KEY", "9PWM3PGAOU5TESTINGKEY")
 	secretKey := GetEnv("S3_SECRET_KEY", "p4KQAm5cLKfW2QoJG8SI5JOI3gYSECRETKEY")
+	sessionToken := ""
+	credentialsProvider := "static"
+	credentialsFile := ""
+	credentialsProfile := ""
+	secure := false
+	caCert := ""
+	insecureSkipVerify := false
+	dialTimeout := 30 * time.Second
+	tlsHandshakeTimeout := 10 * time.Second
+	maxIdleConnsPerHost := 16
+	disableKeepAlives := false
+	backend := "s3"
+	region := ""
+	bucketLookup := "auto"
+	regionHeader := "X-Amz-Bucket-Region"
 	latencyBucketName := "monitoring-latency-test"
 	durabilityBucketName := "monitoring-durab-test"
+	normalizeBucketNames := false
 	probeRatePerMin := 120
 	durabilityProbeRatePerMin := 1
 	latencyItemSize := 10
+	latencyItemSizes := ""
 	durabilityItemSize := 10
 	durabilityItemTotal := 10
+	durabilitySampleSize := 5
 	interval := time.Duration(1)
+	once := false
+	logFormat := "text"
+	logLevel := "debug"
+	durabilityReadyThreshold := 1.0
 	durabilityTimeout := time.Duration(60_000_000_000)
 	latencyTimeout := time.Duration(5_000_000_000)
+	latencyMetric := "both"
+	latencyHistogramBuckets := ""
+	listObjectsMaxKeys := 0
+	rangeGetSize := 256
+	lifecycleExpirationDays := 1
+	objectNameLength := 40
+	objectNameCharset := "hex"
+	versioningProbe := false
+	versioningBucketName := "monitoring-versioning-test"
+	objectLockProbe := false
+	objectLockBucketName := "monitoring-object-lock-test"
+	largeStatProbe := false
+	largeStatObject := "monitoring-stat-large-object"
+	largeStatSize := 1024
+	largeStatSamples := 3
+	largeStatRatio := 5.0
+	multipartProbeRatePerMin := 0
+	multipartPartSize := 5 * 1024 * 1024
+	multipartParts := 2
+	overwriteProbeRatePerMin := 0
+	readAfterWriteRatePerMin := 0
+	readAfterWriteWindow := 500 * time.Millisecond
+	probeJitter := 0.1
+	overwriteCount := 3
+	usageFetcher := ""
+	notificationSink := ""
+	notificationTimeout := 1 * time.Second
+	sendContentMD5 := false
+	contentMD5Probe := false
+	copyProbe := false
+	taggingProbe := false
+	removeObjectsProbe := false
+	bucketProbe := false
+	removeObjectsCount := 3
+	presignProbe := false
+	preflightProbe := false
+	preflightOrigin := "https://example.com"
+	edgeLagTimeout := 1 * time.Second
+	seedMinDelay := 100 * time.Millisecond
+	seedMaxDelay := 1 * time.Second
+	seedRetryMinDelay := 1 * time.Millisecond
+	seedRetryMaxDelay := 10 * time.Millisecond
+	seedMaxRetries := 3
+	seedWorkers := 2
 
 	return Config{
 		ConsulAddr:                &dummyValue,
@@ -79,18 +277,84 @@ func GetTestConfig() Config {
 		LatencyBucketName:         &latencyBucketName,
 		GatewayBucketName:         &latencyBucketName,
 		DurabilityBucketName:      &durabilityBucketName,
+		NormalizeBucketNames:      &normalizeBucketNames,
 		Interval:                  &interval,
+		Once:                      &once,
 		Addr:                      &dummyValue,
+		LogFormat:                 &logFormat,
+		LogLevel:                  &logLevel,
 		ProbeRatePerMin:           &probeRatePerMin,
 		DurabilityProbeRatePerMin: &durabilityProbeRatePerMin,
 		LatencyItemSize:           &latencyItemSize,
+		LatencyItemSizes:          &latencyItemSizes,
 		DurabilityItemSize:        &durabilityItemSize,
 		DurabilityItemTotal:       &durabilityItemTotal,
+		DurabilitySampleSize:      &durabilitySampleSize,
+		DurabilityReadyThreshold:  &durabilityReadyThreshold,
 		DurabilityTimeout:         &durabilityTimeout,
 		LatencyTimeout:            &latencyTimeout,
+		LatencyMetric:             &latencyMetric,
+		LatencyHistogramBuckets:   &latencyHistogramBuckets,
+		ListObjectsMaxKeys:        &listObjectsMaxKeys,
+		RangeGetSize:              &rangeGetSize,
+		LifecycleExpirationDays:   &lifecycleExpirationDays,
+		ObjectNameLength:          &objectNameLength,
+		ObjectNameCharset:         &objectNameCharset,
+		VersioningProbe:           &versioningProbe,
+		VersioningBucketName:      &versioningBucketName,
+		ObjectLockProbe:           &objectLockProbe,
+		ObjectLockBucketName:      &objectLockBucketName,
+		LargeStatProbe:            &largeStatProbe,
+		LargeStatObject:           &largeStatObject,
+		LargeStatSize:             &largeStatSize,
+		LargeStatSamples:          &largeStatSamples,
+		LargeStatRatio:            &largeStatRatio,
+		MultipartProbeRatePerMin:  &multipartProbeRatePerMin,
+		MultipartPartSize:         &multipartPartSize,
+		MultipartParts:            &multipartParts,
+		OverwriteProbeRatePerMin:  &overwriteProbeRatePerMin,
+		ReadAfterWriteRatePerMin:  &readAfterWriteRatePerMin,
+		ReadAfterWriteWindow:      &readAfterWriteWindow,
+		ProbeJitter:               &probeJitter,
+		OverwriteCount:            &overwriteCount,
+		UsageFetcher:              &usageFetcher,
+		NotificationSink:          &notificationSink,
+		NotificationTimeout:       &notificationTimeout,
+		SendContentMD5:            &sendContentMD5,
+		ContentMD5Probe:           &contentMD5Probe,
+		CopyProbe:                 &copyProbe,
+		TaggingProbe:              &taggingProbe,
+		RemoveObjectsProbe:        &removeObjectsProbe,
+		BucketProbe:               &bucketProbe,
+		RemoveObjectsCount:        &removeObjectsCount,
+		PresignProbe:              &presignProbe,
+		PreflightProbe:            &preflightProbe,
+		PreflightOrigin:           &preflightOrigin,
+		EdgeLagTimeout:            &edgeLagTimeout,
+		SeedMinDelay:              &seedMinDelay,
+		SeedMaxDelay:              &seedMaxDelay,
+		SeedRetryMinDelay:         &seedRetryMinDelay,
+		SeedRetryMaxDelay:         &seedRetryMaxDelay,
+		SeedMaxRetries:            &seedMaxRetries,
+		SeedWorkers:               &seedWorkers,
 
-		AccessKey: &accessKey,
-		SecretKey: &secretKey,
+		AccessKey:           &accessKey,
+		SecretKey:           &secretKey,
+		SessionToken:        &sessionToken,
+		CredentialsProvider: &credentialsProvider,
+		CredentialsFile:     &credentialsFile,
+		CredentialsProfile:  &credentialsProfile,
+		Secure:              &secure,
+		CACert:              &caCert,
+		InsecureSkipVerify:  &insecureSkipVerify,
+		DialTimeout:         &dialTimeout,
+		TLSHandshakeTimeout: &tlsHandshakeTimeout,
+		MaxIdleConnsPerHost: &maxIdleConnsPerHost,
+		DisableKeepAlives:   &disableKeepAlives,
+		Backend:             &backend,
+		Region:              &region,
+		BucketLookup:        &bucketLookup,
+		RegionHeader:        &regionHeader,
 	}
 }
 
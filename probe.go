@@ -1,25 +1,91 @@
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/criteo/s3-probe/config"
+	"github.com/criteo/s3-probe/probe"
 	"github.com/criteo/s3-probe/watcher"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	_ "net/http/pprof"
 )
 
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(200)
+// runMemoryProbe runs a single probe against an in-memory S3 backend, without consul
+func runMemoryProbe(cfg config.Config) {
+	p, err := probe.NewProbe(probe.S3Service{Name: "memory"}, "memory", []probe.S3Endpoint{}, &cfg)
+	if err != nil {
+		log.Fatalln("Error while creating probe:", err)
+	}
+	http.Handle("/healthz", p.LivenessHandler())
+	http.Handle("/ready", p.ReadinessHandler())
+	ctx := signalContext()
+	if *cfg.Once {
+		exitOnFailure(p.RunOnce(ctx))
+		return
+	}
+	if err = p.PrepareProbing(ctx); err != nil {
+		if ctx.Err() != nil {
+			log.Println("Probe preparation interrupted")
+			return
+		}
+		log.Fatalln("Error while preparing probe:", err)
+	}
+	p.StartProbing(ctx)
+}
+
+// signalContext returns a context cancelled on SIGINT/SIGTERM, to stop probing gracefully
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	return ctx
+}
+
+// exitOnFailure exits with a nonzero status when the single probe cycle failed
+func exitOnFailure(err error) {
+	if err != nil {
+		log.Fatalln("Probe cycle failed:", err)
+	}
+	log.Println("Probe cycle succeeded")
 }
 
 func main() {
 	cfg := config.ParseConfig()
-	w := watcher.NewWatcher(cfg)
+	if err := probe.ConfigureLatencyHistogram(*cfg.LatencyHistogramBuckets); err != nil {
+		log.Fatalln("Error while configuring the latency histogram:", err)
+	}
+
+	logger, err := probe.NewLogger(os.Stderr, *cfg.LogFormat, *cfg.LogLevel)
+	if err != nil {
+		log.Fatalln("Error while configuring the logger:", err)
+	}
+	webhookSink := probe.NewWebhookNotificationSink()
+	webhookSink.SetLogger(logger)
+	probe.RegisterNotificationSink("webhook", webhookSink)
 
-	http.HandleFunc("/ready", healthCheck)
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/notifications", webhookSink)
 
 	go http.ListenAndServe(*cfg.Addr, nil)
-	w.WatchPools(*cfg.Interval)
+	if *cfg.Backend == "memory" {
+		runMemoryProbe(cfg)
+		return
+	}
+	w := watcher.NewWatcher(cfg)
+	if *cfg.Once {
+		exitOnFailure(w.RunOnce(signalContext()))
+		return
+	}
+	http.Handle("/healthz", w.LivenessHandler())
+	http.Handle("/ready", w.ReadinessHandler())
+	w.WatchPools(signalContext(), *cfg.Interval)
 }
@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// normalizeBucketName returns the bucket name as most endpoints store it: trimmed and lowercased
+func normalizeBucketName(bucketName string) string {
+	return strings.ToLower(strings.TrimSpace(bucketName))
+}
+
+// bucketExists validates the bucket name before checking if the bucket exists: names
+// that are not strictly valid are handled differently from one endpoint to another
+func bucketExists(client S3Client, bucketName string) (bool, error) {
+	if err := s3utils.CheckValidBucketNameStrict(bucketName); err != nil {
+		if normalized := normalizeBucketName(bucketName); normalized != bucketName && s3utils.CheckValidBucketNameStrict(normalized) == nil {
+			return false, fmt.Errorf("Invalid bucket name %q (use -normalize-bucket-names to use %q): %s", bucketName, normalized, err)
+		}
+		return false, fmt.Errorf("Invalid bucket name %q: %s", bucketName, err)
+	}
+	return client.BucketExists(context.Background(), bucketName)
+}
+
+// bucketUsable checks if the bucket can be listed, for users allowed to use a bucket
+// but not to create it (or to check its existence)
+func bucketUsable(client S3Client, bucketName string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for object := range client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{MaxKeys: 1}) {
+		return object.Err
+	}
+	return nil
+}
+
+// makeBucket creates a bucket that BucketExists reported as missing. Endpoints normalizing
+// bucket names can miss an existing bucket on BucketExists and then refuse to create it with
+// BucketAlreadyOwnedByYou: the bucket is reconciled as existing and created is false.
+// Other creation errors are ignored as long as the bucket is usable. Buckets are created in the
+// region of the probe unless opts sets another one
+func (p *Probe) makeBucket(client S3Client, bucketName string, opts minio.MakeBucketOptions) (created bool, err error) {
+	if opts.Region == "" {
+		opts.Region = p.region
+	}
+	err = client.MakeBucket(context.Background(), bucketName, opts)
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).Code == "BucketAlreadyOwnedByYou" {
+		p.log(InfoLevel, "Bucket reported missing but already owned, using the existing bucket", Fields{"bucket": bucketName})
+		probeBucketReconciled.WithLabelValues(p.name, bucketName).Inc()
+		return false, nil
+	}
+	if errUsable := bucketUsable(client, bucketName); errUsable == nil {
+		p.log(InfoLevel, "Cannot create bucket but the bucket is usable, using the existing bucket", Fields{"bucket": bucketName, "error": err})
+		probeBucketReconciled.WithLabelValues(p.name, bucketName).Inc()
+		return false, nil
+	}
+	s3BucketPrepareErrors.WithLabelValues(p.name, bucketName).Inc()
+	return false, err
+}
@@ -0,0 +1,206 @@
+package probe
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// normalizingS3Client mimics endpoints whose BucketExists misses buckets stored under a normalized name
+type normalizingS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *normalizingS3Client) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return false, nil
+}
+
+func TestNormalizeBucketName(t *testing.T) {
+	if name := normalizeBucketName(" Monitoring-Latency "); name != "monitoring-latency" {
+		t.Errorf("Expected monitoring-latency got %s", name)
+	}
+}
+
+func TestBucketExistsRejectsInvalidBucketName(t *testing.T) {
+	client := NewMemoryS3Client()
+	_, err := bucketExists(client, "Monitoring-Latency")
+	if err == nil || !strings.Contains(err.Error(), "-normalize-bucket-names") {
+		t.Errorf("Expected an error suggesting normalization got %v", err)
+	}
+	_, err = bucketExists(client, "monitoring_latency")
+	if err == nil || strings.Contains(err.Error(), "-normalize-bucket-names") {
+		t.Errorf("Expected an invalid bucket name error got %v", err)
+	}
+}
+
+func TestPrepareBucketReconcilesAlreadyOwnedBucket(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-reconcile")
+	client := &normalizingS3Client{NewMemoryS3Client()}
+	probe.endpoint.s3Client = client
+	client.MakeBucket(context.Background(), probe.latencyBucketName, minio.MakeBucketOptions{})
+	client.MakeBucket(context.Background(), probe.durabilityBucketName, minio.MakeBucketOptions{})
+
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Latency bucket preparation failed: %s", err)
+	}
+	if err := probe.prepareDurabilityBucket(context.Background()); err != nil {
+		t.Errorf("Durability bucket preparation failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	probeBucketReconciled.WithLabelValues("bucket-reconcile", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Counter.Value)
+	}
+	probeBucketReconciled.WithLabelValues("bucket-reconcile", probe.durabilityBucketName).Write(metric)
+	if *metric.Counter.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Counter.Value)
+	}
+}
+
+// lifecycleRecordingS3Client records the lifecycle configurations set on the buckets
+type lifecycleRecordingS3Client struct {
+	*MemoryS3Client
+	lifecycles []*lifecycle.Configuration
+}
+
+func (c *lifecycleRecordingS3Client) SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error {
+	c.lifecycles = append(c.lifecycles, config)
+	return c.MemoryS3Client.SetBucketLifecycle(ctx, bucketName, config)
+}
+
+func TestPrepareLatencyBucketSetsLifecycleExpiration(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-lifecycle")
+	client := &lifecycleRecordingS3Client{MemoryS3Client: NewMemoryS3Client()}
+	probe.endpoint.s3Client = client
+	probe.lifecycleExpirationDays = 3
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Latency bucket preparation failed: %s", err)
+	}
+	if len(client.lifecycles) != 1 || client.lifecycles[0].Rules[0].Expiration.Days != 3 {
+		t.Errorf("Expected a 3 days expiration got %v", client.lifecycles)
+	}
+
+	probe.latencyBucketName = probe.latencyBucketName + "-disabled"
+	probe.lifecycleExpirationDays = 0
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Latency bucket preparation failed: %s", err)
+	}
+	if len(client.lifecycles) != 1 {
+		t.Errorf("No lifecycle should be set when disabled")
+	}
+}
+
+// deniedMakeBucketS3Client mimics users allowed to use buckets but not to create them
+type deniedMakeBucketS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *deniedMakeBucketS3Client) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return false, nil
+}
+
+func (c *deniedMakeBucketS3Client) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	return minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}
+}
+
+func TestPrepareBucketUsesUsableBucketWhenCreationDenied(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-denied-usable")
+	memoryClient := NewMemoryS3Client()
+	memoryClient.MakeBucket(context.Background(), probe.latencyBucketName, minio.MakeBucketOptions{})
+	probe.endpoint.s3Client = &deniedMakeBucketS3Client{memoryClient}
+
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Latency bucket preparation failed: %s", err)
+	}
+	metric := &io_prometheus_client.Metric{}
+	probeBucketReconciled.WithLabelValues("bucket-denied-usable", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Counter.Value)
+	}
+}
+
+func TestPrepareBucketFailsWhenCreationDeniedAndBucketMissing(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-denied-missing")
+	probe.endpoint.s3Client = &deniedMakeBucketS3Client{NewMemoryS3Client()}
+
+	if err := probe.prepareLatencyBucket(); err == nil {
+		t.Errorf("Latency bucket preparation should fail")
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3BucketPrepareErrors.WithLabelValues("bucket-denied-missing", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Counter.Value)
+	}
+}
+
+// regionRecordingS3Client records the region of the created buckets
+type regionRecordingS3Client struct {
+	*MemoryS3Client
+	regions map[string]string
+}
+
+func (c *regionRecordingS3Client) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	c.regions[bucketName] = opts.Region
+	return c.MemoryS3Client.MakeBucket(ctx, bucketName, opts)
+}
+
+func TestPrepareBucketsCreatesBucketsInProbeRegion(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-region")
+	probe.region = "eu-west-1"
+	client := &regionRecordingS3Client{NewMemoryS3Client(), map[string]string{}}
+	probe.endpoint.s3Client = client
+
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Latency bucket preparation failed: %s", err)
+	}
+	if err := probe.prepareDurabilityBucket(context.Background()); err != nil {
+		t.Errorf("Durability bucket preparation failed: %s", err)
+	}
+	for _, bucketName := range []string{probe.latencyBucketName, probe.durabilityBucketName} {
+		if region := client.regions[bucketName]; region != "eu-west-1" {
+			t.Errorf("Expected %s to be created in eu-west-1 got %q", bucketName, region)
+		}
+	}
+}
+
+func TestPrepareDurabilityBucketBackfillsMissingItems(t *testing.T) {
+	probe := getMemoryTestProbe("durability-backfill")
+	client := probe.endpoint.s3Client
+	ctx := context.Background()
+	client.MakeBucket(ctx, probe.durabilityBucketName, minio.MakeBucketOptions{})
+	for i := 0; i < probe.durabilityItemTotal; i++ {
+		if i == 3 || i == 7 {
+			continue
+		}
+		client.PutObject(ctx, probe.durabilityBucketName, durabilityObjectName(i), strings.NewReader("item"), 4, minio.PutObjectOptions{})
+	}
+	client.PutObject(ctx, probe.durabilityBucketName, "unrelated", strings.NewReader("item"), 4, minio.PutObjectOptions{})
+
+	if err := probe.prepareDurabilityBucket(context.Background()); err != nil {
+		t.Errorf("Durability bucket preparation failed: %s", err)
+	}
+	if !probe.isDurabilityReady() {
+		t.Errorf("Durability bucket should be ready once backfilled")
+	}
+	for i := 0; i < probe.durabilityItemTotal; i++ {
+		if _, err := client.StatObject(ctx, probe.durabilityBucketName, durabilityObjectName(i), minio.StatObjectOptions{}); err != nil {
+			t.Errorf("Durability item %d is missing: %s", i, err)
+		}
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	probeSeedBackfilledItems.WithLabelValues("durability-backfill").Write(metric)
+	if *metric.Counter.Value != 2 {
+		t.Errorf("Expected 2 backfilled items got %f", *metric.Counter.Value)
+	}
+	// Only the missing items are written again
+	s3BytesUploaded.WithLabelValues("durability_seed", "durability-backfill").Write(metric)
+	if expected := float64(2 * probe.durabilityItemSize); *metric.Counter.Value != expected {
+		t.Errorf("Expected %f bytes uploaded got %f", expected, *metric.Counter.Value)
+	}
+}
@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"context"
+	"strings"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// maxBucketNameLength is the maximum length of a bucket name
+const maxBucketNameLength = 63
+
+// temporaryBucketName returns a unique bucket name derived from the latency bucket name
+func (p *Probe) temporaryBucketName() string {
+	suffix, _ := randomHex(8)
+	prefix := p.latencyBucketName
+	if len(prefix)+len("-tmp-")+len(suffix) > maxBucketNameLength {
+		// The cut may end on a separator, which would make the name invalid (e.g. foo.-tmp-)
+		prefix = strings.TrimRight(prefix[:maxBucketNameLength-len("-tmp-")-len(suffix)], ".-")
+	}
+	return prefix + "-tmp-" + suffix
+}
+
+// performBucketChecks creates a temporary bucket then removes it to measure the latency of the
+// control plane. A bucket whose creation failed is still removed as it may have been created
+func (p *Probe) performBucketChecks() error {
+	bucketName := p.temporaryBucketName()
+	operation := func(ctx context.Context) error {
+		return p.endpoint.s3Client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: p.region})
+	}
+	if err := p.mesureOperation("make_bucket", "", operation); err != nil {
+		p.cleanupTemporaryBucket(bucketName)
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveBucket(ctx, bucketName)
+	}
+	if err := p.mesureOperation("remove_bucket", "", operation); err != nil {
+		p.cleanupTemporaryBucket(bucketName)
+		return err
+	}
+	return nil
+}
+
+// cleanupTemporaryBucket removes the temporary bucket without measuring the operation
+func (p *Probe) cleanupTemporaryBucket(bucketName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.latencyTimeout)
+	defer cancel()
+	err := p.endpoint.s3Client.RemoveBucket(ctx, bucketName)
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchBucket" {
+		p.log(WarnLevel, "Cannot remove temporary bucket", Fields{"bucket": bucketName, "error": err})
+	}
+}
@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// ambiguousMakeBucketS3Client mimics an endpoint creating the bucket but failing to answer
+type ambiguousMakeBucketS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *ambiguousMakeBucketS3Client) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	c.MemoryS3Client.MakeBucket(ctx, bucketName, opts)
+	return minio.ErrorResponse{Code: "InternalError", StatusCode: 500}
+}
+
+func TestTemporaryBucketNameIsValid(t *testing.T) {
+	probe := getMemoryTestProbe("temporary-bucket-name")
+	probe.latencyBucketName = "monitoring-latency-with-a-very-long-name-for-a-bucket-name"
+	if bucketName := probe.temporaryBucketName(); len(bucketName) > maxBucketNameLength {
+		t.Errorf("Temporary bucket name %s is longer than %d characters", bucketName, maxBucketNameLength)
+	}
+
+	// The truncated prefix must not end with a separator
+	probe.latencyBucketName = strings.Repeat("a", 40) + "-.bucket"
+	if bucketName := probe.temporaryBucketName(); !strings.HasPrefix(bucketName, strings.Repeat("a", 40)+"-tmp-") {
+		t.Errorf("Temporary bucket name %s should not keep the separators at the cut", bucketName)
+	}
+}
+
+func TestPerformBucketCheckOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-probe")
+	if err := probe.performBucketChecks(); err != nil {
+		t.Errorf("Bucket check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	for _, operation := range []string{"make_bucket", "remove_bucket"} {
+		s3SuccessCounter.WithLabelValues(operation, "bucket-probe", "").Write(metric)
+		if *metric.Counter.Value != 1 {
+			t.Errorf("Expected 1 successful %s got %f", operation, *metric.Counter.Value)
+		}
+	}
+	buckets, _ := probe.endpoint.s3Client.ListBuckets(context.Background())
+	if len(buckets) != 0 {
+		t.Errorf("Expected the temporary bucket to be removed got %v", buckets)
+	}
+}
+
+func TestBucketCheckCleansUpAfterFailedCreation(t *testing.T) {
+	probe := getMemoryTestProbe("bucket-probe-cleanup")
+	probe.endpoint.s3Client = &ambiguousMakeBucketS3Client{NewMemoryS3Client()}
+	if err := probe.performBucketChecks(); err == nil {
+		t.Errorf("Bucket check should fail when the creation fails")
+	}
+	buckets, _ := probe.endpoint.s3Client.ListBuckets(context.Background())
+	if len(buckets) != 0 {
+		t.Errorf("Expected the temporary bucket to be removed got %v", buckets)
+	}
+}
@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/criteo/s3-probe/config"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+// S3Object is the body of an object returned by S3Client.GetObject
+type S3Object interface {
+	io.ReadCloser
+	Stat() (minio.ObjectInfo, error)
+}
+
+// S3Client lists the S3 operations performed by the probe, it is implemented
+// by minio for real endpoints and by MemoryS3Client for tests and local runs
+type S3Client interface {
+	ListBuckets(ctx context.Context) ([]minio.BucketInfo, error)
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error
+	RemoveBucket(ctx context.Context, bucketName string) error
+	SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error
+	EnableVersioning(ctx context.Context, bucketName string) error
+	GetObjectLockConfig(ctx context.Context, bucketName string) (string, *minio.RetentionMode, *uint, *minio.ValidityUnit, error)
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	// PutObjectWithMD5 uploads the object in a single request with the given Content-MD5 header
+	PutObjectWithMD5(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, md5Base64 string, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error)
+	StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
+	RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+	PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error
+	GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error)
+	PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+	NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (string, error)
+	PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partID int, reader io.Reader, size int64) (minio.ObjectPart, error)
+	ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker int, maxParts int) (minio.ListObjectPartsResult, error)
+	CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart) (string, error)
+	AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error
+	ListMultipartUploads(ctx context.Context, bucketName, prefix string, maxUploads int) (minio.ListMultipartUploadsResult, error)
+}
+
+// minioS3Client implements S3Client on top of the minio client, low level
+// operations are forwarded to minio.Core
+type minioS3Client struct {
+	*minio.Client
+	core minio.Core
+}
+
+func newMinioS3Client(client *minio.Client) *minioS3Client {
+	return &minioS3Client{Client: client, core: minio.Core{Client: client}}
+}
+
+func (c *minioS3Client) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error) {
+	return c.Client.GetObject(ctx, bucketName, objectName, opts)
+}
+
+func (c *minioS3Client) PutObjectWithMD5(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, md5Base64 string, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return c.core.PutObject(ctx, bucketName, objectName, reader, objectSize, md5Base64, "", opts)
+}
+
+func (c *minioS3Client) NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (string, error) {
+	return c.core.NewMultipartUpload(ctx, bucketName, objectName, opts)
+}
+
+func (c *minioS3Client) PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partID int, reader io.Reader, size int64) (minio.ObjectPart, error) {
+	return c.core.PutObjectPart(ctx, bucketName, objectName, uploadID, partID, reader, size, "", "", nil)
+}
+
+func (c *minioS3Client) ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker int, maxParts int) (minio.ListObjectPartsResult, error) {
+	return c.core.ListObjectParts(ctx, bucketName, objectName, uploadID, partNumberMarker, maxParts)
+}
+
+func (c *minioS3Client) CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart) (string, error) {
+	return c.core.CompleteMultipartUpload(ctx, bucketName, objectName, uploadID, parts)
+}
+
+func (c *minioS3Client) AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error {
+	return c.core.AbortMultipartUpload(ctx, bucketName, objectName, uploadID)
+}
+
+func (c *minioS3Client) ListMultipartUploads(ctx context.Context, bucketName, prefix string, maxUploads int) (minio.ListMultipartUploadsResult, error) {
+	return c.core.ListMultipartUploads(ctx, bucketName, prefix, "", "", "", maxUploads)
+}
+
+// parseBucketLookup returns the addressing style of the buckets: path-style (endpoint/bucket),
+// virtual-hosted-style (bucket.endpoint) or auto to let minio pick one from the endpoint
+func parseBucketLookup(bucketLookup string) (minio.BucketLookupType, error) {
+	switch bucketLookup {
+	case "auto":
+		return minio.BucketLookupAuto, nil
+	case "path":
+		return minio.BucketLookupPath, nil
+	case "dns":
+		return minio.BucketLookupDNS, nil
+	}
+	return minio.BucketLookupAuto, fmt.Errorf("Unknown bucket lookup: %s (must be auto, path or dns)", bucketLookup)
+}
+
+// newS3Client creates the client of the endpoint for the configured backend
+func newS3Client(endpoint string, cfg *config.Config) (S3Client, error) {
+	switch *cfg.Backend {
+	case "s3":
+		client, err := newMinioClientFromEndpoint(endpoint, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return newMinioS3Client(client), nil
+	case "memory":
+		return getMemoryS3Client(endpoint), nil
+	}
+	return nil, fmt.Errorf("Unknown backend: %s", *cfg.Backend)
+}
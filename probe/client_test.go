@@ -0,0 +1,49 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/criteo/s3-probe/config"
+	minio "github.com/minio/minio-go/v7"
+)
+
+func TestParseBucketLookup(t *testing.T) {
+	if lookup, err := parseBucketLookup("path"); err != nil || lookup != minio.BucketLookupPath {
+		t.Errorf("Expected path lookup got %v (%v)", lookup, err)
+	}
+	if lookup, err := parseBucketLookup("dns"); err != nil || lookup != minio.BucketLookupDNS {
+		t.Errorf("Expected dns lookup got %v (%v)", lookup, err)
+	}
+	if _, err := parseBucketLookup("virtual"); err == nil {
+		t.Errorf("Unknown bucket lookups should be rejected")
+	}
+}
+
+func TestMinioClientUsesPathStyleBucketLookup(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := config.GetTestConfig()
+	bucketLookup := "path"
+	cfg.BucketLookup = &bucketLookup
+	endpoint := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	client, err := newMinioClientFromEndpoint(endpoint, &cfg)
+	if err != nil {
+		t.Fatalf("Client creation failed: %s", err)
+	}
+	// The empty answers of the server are not valid S3 answers, only the request matters
+	client.BucketExists(context.Background(), "my-bucket")
+
+	request := <-requests
+	if !strings.HasPrefix(request.URL.Path, "/my-bucket") || strings.HasPrefix(request.Host, "my-bucket.") {
+		t.Errorf("Expected a path-style request got %s%s", request.Host, request.URL.Path)
+	}
+}
@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+const readAfterWriteMinDelay = 10 * time.Millisecond
+const readAfterWriteMaxDelay = 500 * time.Millisecond
+
+// performReadAfterWriteChecks writes an object and stats it right away. Eventually consistent endpoints
+// can answer NoSuchKey for a while: the stat is retried with a backoff until the object is visible, the
+// time it took is the time to consistency. Objects still missing after readAfterWriteWindow are counted
+func (p *Probe) performReadAfterWriteChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	payload, _ := randomPayload(objectSize)
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("read_after_write_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("read_after_write_remove_object", p.latencyBucketName, operation)
+	}()
+
+	start := time.Now()
+	backoff := newRetryBackoff(readAfterWriteMinDelay, readAfterWriteMaxDelay)
+	for {
+		ctx, cancel := context.WithTimeout(p.ctx, p.latencyTimeout)
+		_, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, objectName, minio.StatObjectOptions{})
+		cancel()
+		if err == nil {
+			s3ReadAfterWrite.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+			return nil
+		}
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return err
+		}
+
+		delay := backoff.next()
+		if time.Since(start)+delay > p.readAfterWriteWindow {
+			p.log(WarnLevel, "Object still not readable after its write", Fields{"object": objectName, "elapsed": time.Since(start)})
+			s3ReadAfterWriteInconsistent.WithLabelValues(p.name).Inc()
+			return fmt.Errorf("Object %s not readable within %s after its write", objectName, p.readAfterWriteWindow)
+		}
+		select {
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
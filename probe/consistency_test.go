@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// laggingS3Client mimics an eventually consistent endpoint: objects are only visible lag after their write
+type laggingS3Client struct {
+	*MemoryS3Client
+	lag time.Duration
+}
+
+func (c *laggingS3Client) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	info, err := c.MemoryS3Client.StatObject(ctx, bucketName, objectName, opts)
+	if err == nil && time.Since(info.LastModified) < c.lag {
+		return minio.ObjectInfo{}, memoryError("NoSuchKey", http.StatusNotFound, bucketName, objectName)
+	}
+	return info, err
+}
+
+func TestReadAfterWriteCheckMeasuresTimeToConsistency(t *testing.T) {
+	probe := getMemoryTestProbe("read-after-write")
+	probe.endpoint.s3Client = &laggingS3Client{MemoryS3Client: NewMemoryS3Client(), lag: 50 * time.Millisecond}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performReadAfterWriteChecks(); err != nil {
+		t.Errorf("Read-after-write check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3ReadAfterWrite.WithLabelValues("read-after-write").(prometheus.Metric).Write(metric)
+	if *metric.Histogram.SampleCount != 1 || *metric.Histogram.SampleSum < 0.04 {
+		t.Errorf("Expected 1 sample of at least 40ms got %v", metric.Histogram)
+	}
+}
+
+func TestReadAfterWriteCheckCountsInconsistentObjects(t *testing.T) {
+	probe := getMemoryTestProbe("read-after-write-inconsistent")
+	probe.endpoint.s3Client = &laggingS3Client{MemoryS3Client: NewMemoryS3Client(), lag: time.Hour}
+	probe.readAfterWriteWindow = 100 * time.Millisecond
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performReadAfterWriteChecks(); err == nil {
+		t.Errorf("Read-after-write check should fail when the object is never readable")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3ReadAfterWriteInconsistent.WithLabelValues("read-after-write-inconsistent").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 inconsistent object got %f", *metric.Counter.Value)
+	}
+}
@@ -14,7 +14,7 @@ import (
 // ConsulClient is a wrapper around true consul client to ease mocking
 type ConsulClient interface {
 	GetAllMatchingRegisteredServices() (map[string]bool, error)
-	GetServiceEndPoints(serviceName string, isGateway bool) (string, []S3Endpoint, error)
+	GetServiceEndPoints(serviceName string, isGateway bool) (string, []S3Endpoint, string, error)
 }
 
 // concrete implementation
@@ -29,6 +29,7 @@ type S3Service struct {
 	Endpoint            string
 	Gateway             bool
 	GatewayReadEnpoints []S3Endpoint
+	EdgeEndpoint        string
 }
 
 // Equals checks that to S3Service description are identical
@@ -36,6 +37,7 @@ func (s *S3Service) Equals(other *S3Service) bool {
 	if s.Name != other.Name ||
 		s.Endpoint != other.Endpoint ||
 		s.Gateway != other.Gateway ||
+		s.EdgeEndpoint != other.EdgeEndpoint ||
 		len(s.GatewayReadEnpoints) != len(other.GatewayReadEnpoints) {
 		return false
 	}
@@ -85,36 +87,39 @@ func (cc *consulClientImpl) GetAllMatchingRegisteredServices() (map[string]bool,
 	return results, nil
 }
 
-// getServiceEndPoint resolves the endpoint address of the given serviceName via consul
-func (cc *consulClientImpl) GetServiceEndPoints(serviceName string, isGateway bool) (string, []S3Endpoint, error) {
+// getServiceEndPoint resolves the endpoint address of the given serviceName via consul, with the
+// read endpoints of gateways or the address of the edge/cache endpoint in front of other services
+// (from the edge_address service metadata, empty if the service has no edge)
+func (cc *consulClientImpl) GetServiceEndPoints(serviceName string, isGateway bool) (string, []S3Endpoint, string, error) {
 	health := cc.consulClient.Health()
 	serviceEntries, _, err := health.Service(serviceName, "", false, nil)
 	if err != nil {
 		log.Printf("Fail to query health information for service %s from consul: %s\n", serviceName, err)
-		return "", []S3Endpoint{}, err
+		return "", []S3Endpoint{}, "", err
 	}
 
 	endpoint, err := getEndpointFromConsul(serviceName, *cc.cfg.EndpointSuffix, serviceEntries)
 	if err != nil {
 		log.Printf("Fail to resolve service endpoint from consul service entries for service %s: %s\n", serviceName, err)
-		return "", []S3Endpoint{}, err
+		return "", []S3Endpoint{}, "", err
 	}
 
 	if isGateway {
 		readEndpoints, err := extractGatewayEndoints(serviceEntries, cc.cfg, cc.consulClient)
 		if err != nil {
 			log.Printf("Resolving gateway endpoints failed for %s: %s", serviceName, err)
-			return "", []S3Endpoint{}, err
+			return "", []S3Endpoint{}, "", err
 		}
-		return endpoint, readEndpoints, err
+		return endpoint, readEndpoints, "", err
 	}
 
-	return endpoint, []S3Endpoint{}, nil
+	edge, _ := getEdgeEndpoint(serviceEntries)
+	return endpoint, []S3Endpoint{}, edge, nil
 }
 
 // NewProbeFromConsul Create a new probe using consul to generate endpoint configuration
-func NewProbeFromConsul(service S3Service, cfg *config.Config, controlChan chan bool) (Probe, error) {
-	return NewProbe(service, service.Endpoint, service.GatewayReadEnpoints, cfg, controlChan)
+func NewProbeFromConsul(service S3Service, cfg *config.Config) (Probe, error) {
+	return NewProbe(service, service.Endpoint, service.GatewayReadEnpoints, cfg)
 }
 
 func getEndpointFromConsul(name string, endpointSuffix string, serviceEntries []*consul_api.ServiceEntry) (string, error) {
@@ -155,12 +160,12 @@ func extractGatewayEndoints(serviceEntries []*consul_api.ServiceEntry, cfg *conf
 		if err != nil {
 			return s3endpoints, err
 		}
-		minioClient, err := newMinioClientFromEndpoint(endpointName, *cfg.AccessKey, *cfg.SecretKey)
+		s3Client, err := newS3Client(endpointName, cfg)
 		if err != nil {
 			log.Printf("Could not create minio client for %s (dc: %s, service: %s) : %s", destination.raw, destination.datacenter, destination.service, err)
 			return []S3Endpoint{}, err
 		}
-		s3endpoints = append(s3endpoints, S3Endpoint{Name: endpointName, s3Client: minioClient})
+		s3endpoints = append(s3endpoints, S3Endpoint{Name: endpointName, s3Client: s3Client})
 		log.Printf("Added gateway destination: %s", endpointName)
 	}
 	return s3endpoints, nil
@@ -210,6 +215,17 @@ func getDatacenter(serviceEntries []*consul_api.ServiceEntry) (string, error) {
 	return serviceEntries[0].Node.Datacenter, nil
 }
 
+// getEdgeEndpoint return the first edge address found in the service metadata
+func getEdgeEndpoint(serviceEntries []*consul_api.ServiceEntry) (string, bool) {
+	for i := range serviceEntries {
+		value, ok := serviceEntries[i].Service.Meta["edge_address"]
+		if ok {
+			return value, ok
+		}
+	}
+	return "", false
+}
+
 // getServicePort return the first port found in the service or 80
 func getProxyEndpoint(serviceEntries []*consul_api.ServiceEntry) (string, bool) {
 	ok := false
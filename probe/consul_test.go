@@ -37,6 +37,11 @@ func TestS3ServiceEquals(t *testing.T) {
 		t.Error("S3Service equality should have return false due to different list of gateway read endpoints")
 	}
 
+	otherService = S3Service{Name: "my-service", Endpoint: "127.0.0.1", Gateway: true, GatewayReadEnpoints: []S3Endpoint{{Name: "127.0.0.2"}, {Name: "127.0.0.3"}}, EdgeEndpoint: "edge.local"}
+	if service.Equals(&otherService) {
+		t.Error("S3Service equality should have return false due to different edge endpoint")
+	}
+
 	otherService = S3Service{Name: "my-service", Endpoint: "127.0.0.1", Gateway: true, GatewayReadEnpoints: []S3Endpoint{{Name: "127.0.0.2"}, {Name: "127.0.0.3"}}}
 	if !service.Equals(&otherService) {
 		t.Error("S3Service equality should have return true due to perfect deep equality between both services")
@@ -78,6 +83,18 @@ func TestGenerateEndointFromConsulWithProxyData(t *testing.T) {
 	}
 }
 
+func TestGetEdgeEndpoint(t *testing.T) {
+	entries := getTestServiceEntries()
+	if _, ok := getEdgeEndpoint(entries); ok {
+		t.Errorf("No edge endpoint should be found without edge_address data")
+	}
+	entries[0].Service.Meta["edge_address"] = "edge.foo.bar"
+	edge, ok := getEdgeEndpoint(entries)
+	if edge != "edge.foo.bar" || !ok {
+		t.Errorf("Failed to get edge endpoint from edge_address data")
+	}
+}
+
 func TestExtractDestinations(t *testing.T) {
 	dst1 := destination{datacenter: "us-east-2", service: "barfoo", raw: "us-east-2:barfoo"}
 	dst2 := destination{datacenter: "us-west-1", service: "foobar", raw: "us-west-1:foobar"}
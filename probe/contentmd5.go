@@ -0,0 +1,34 @@
+package probe
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performContentMD5Checks uploads an object with a Content-MD5 header that doesn't match
+// its content, the endpoint is expected to reject it with a BadDigest error
+func (p *Probe) performContentMD5Checks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+
+	wrongDigest := md5.Sum([]byte(objectName))
+	wrongMD5Base64 := base64.StdEncoding.EncodeToString(wrongDigest[:])
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObjectWithMD5(ctx, p.latencyBucketName, objectName, objectData, objectSize, wrongMD5Base64, minio.PutObjectOptions{})
+		if err == nil {
+			p.log(WarnLevel, "Upload with a wrong Content-MD5 was accepted", nil)
+			s3ContentMD5NotEnforced.WithLabelValues(p.name).Inc()
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		if minio.ToErrorResponse(err).Code == "BadDigest" {
+			return nil
+		}
+		return err
+	}
+	return p.mesureOperation("put_object_bad_digest", p.latencyBucketName, operation)
+}
@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performCopyChecks writes an object, copies it server side to a second key and checks the size
+// of the copy, then removes both keys. Endpoints not supporting copies fail on copy_object
+func (p *Probe) performCopyChecks() error {
+	objectName := p.randomObjectName()
+	copyName := objectName + "-copy"
+	objectSize := int64(p.latencyItemSize)
+	payload, _ := randomPayload(objectSize)
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("copy_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer p.removeCopyObject("copy_remove_object", objectName)
+
+	operation = func(ctx context.Context) error {
+		src := minio.CopySrcOptions{Bucket: p.latencyBucketName, Object: objectName}
+		dst := minio.CopyDestOptions{Bucket: p.latencyBucketName, Object: copyName}
+		info, err := p.endpoint.s3Client.CopyObject(ctx, dst, src)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NotImplemented" {
+				p.log(InfoLevel, "Server side copy is not supported by the endpoint", nil)
+			}
+			return err
+		}
+		if info.Size != 0 && info.Size != objectSize {
+			return fmt.Errorf("Expected a copy of %d bytes but got %d", objectSize, info.Size)
+		}
+		return nil
+	}
+	if err := p.mesureOperation("copy_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer p.removeCopyObject("copy_remove_copied_object", copyName)
+
+	operation = func(ctx context.Context) error {
+		info, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, copyName, minio.StatObjectOptions{})
+		if err != nil {
+			return err
+		}
+		if info.Size != objectSize {
+			return fmt.Errorf("Expected a copy of %d bytes but got %d", objectSize, info.Size)
+		}
+		return nil
+	}
+	return p.mesureOperation("copy_stat_object", p.latencyBucketName, operation)
+}
+
+func (p *Probe) removeCopyObject(operationName string, objectName string) {
+	operation := func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+	}
+	p.mesureOperation(operationName, p.latencyBucketName, operation)
+}
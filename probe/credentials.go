@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/criteo/s3-probe/config"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// credentialsError is returned when the credentials of the endpoint can't be retrieved (or refreshed)
+type credentialsError struct {
+	err error
+}
+
+func (e *credentialsError) Error() string {
+	return fmt.Sprintf("Cannot retrieve the S3 credentials: %s", e.err)
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.err
+}
+
+// reportingProvider flags the errors of the credentials provider so a failed refresh
+// is not reported as a failure of the endpoint
+type reportingProvider struct {
+	credentials.Provider
+}
+
+func (p reportingProvider) Retrieve() (credentials.Value, error) {
+	value, err := p.Provider.Retrieve()
+	if err != nil {
+		return value, &credentialsError{err: err}
+	}
+	return value, nil
+}
+
+// newCredentials creates the credentials of the configured provider: static keys (with an optional
+// session token), AWS environment variables, AWS credentials file or IAM role (EC2/ECS metadata).
+// Expiring credentials are refreshed by minio before they expire
+func newCredentials(cfg *config.Config) (*credentials.Credentials, error) {
+	var provider credentials.Provider
+	switch *cfg.CredentialsProvider {
+	case "static":
+		provider = &credentials.Static{Value: credentials.Value{
+			AccessKeyID:     *cfg.AccessKey,
+			SecretAccessKey: *cfg.SecretKey,
+			SessionToken:    *cfg.SessionToken,
+			SignerType:      credentials.SignatureV4,
+		}}
+	case "env":
+		provider = &credentials.EnvAWS{}
+	case "file":
+		provider = &credentials.FileAWSCredentials{Filename: *cfg.CredentialsFile, Profile: *cfg.CredentialsProfile}
+	case "iam":
+		provider = &credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}}
+	default:
+		return nil, fmt.Errorf("Unknown credentials provider: %s (must be static, env, file or iam)", *cfg.CredentialsProvider)
+	}
+	return credentials.New(reportingProvider{provider}), nil
+}
@@ -0,0 +1,44 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+func TestNewCredentialsWithSessionToken(t *testing.T) {
+	cfg := config.GetTestConfig()
+	sessionToken := "token"
+	cfg.SessionToken = &sessionToken
+	creds, err := newCredentials(&cfg)
+	if err != nil {
+		t.Fatalf("Credentials creation failed: %s", err)
+	}
+	value, err := creds.Get()
+	if err != nil || value.SessionToken != "token" || value.AccessKeyID != *cfg.AccessKey {
+		t.Errorf("Expected static credentials with a session token got %v (%v)", value, err)
+	}
+
+	provider := "sts"
+	cfg.CredentialsProvider = &provider
+	if _, err = newCredentials(&cfg); err == nil {
+		t.Errorf("Unknown credentials providers should be rejected")
+	}
+}
+
+func TestCredentialsFailureIsClassified(t *testing.T) {
+	cfg := config.GetTestConfig()
+	provider := "file"
+	credentialsFile := "/nonexistent/credentials"
+	cfg.CredentialsProvider = &provider
+	cfg.CredentialsFile = &credentialsFile
+	client, err := newMinioClientFromEndpoint("localhost:1", &cfg)
+	if err != nil {
+		t.Fatalf("Client creation failed: %s", err)
+	}
+	_, err = client.ListBuckets(context.Background())
+	if reason := classifyError(err); reason != "credentials" {
+		t.Errorf("Expected credentials got %s (%v)", reason, err)
+	}
+}
@@ -0,0 +1,201 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+const durabilityObjectPrefix = "fake-item-"
+
+func durabilityObjectName(index int) string {
+	return durabilityObjectPrefix + strconv.Itoa(index)
+}
+
+// durabilityItemIndexes returns the indexes of all the durability items, 0..total-1
+func durabilityItemIndexes(total int) []int {
+	indexes := make([]int, total)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// seedDurabilityItems writes the durability items of the given indexes using seedWorkers concurrent
+// writers. Once an item exhausted its retries or the context is done no new item is dispatched and
+// the error is returned
+func (p *Probe) seedDurabilityItems(ctx context.Context, items []int) error {
+	objectSize := int64(p.durabilityItemSize)
+	pacer := newSeedPacer(p.seedMinDelay, p.seedMaxDelay)
+	address, _ := parseEndpoint(p.endpoint.Name, p.defaultSecure)
+	retryAfter := getRetryAfterGate(address)
+	defer probeSeedRate.WithLabelValues(p.name).Set(0)
+
+	payload, err := sharedPayload(objectSize)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	total := len(items)
+	var written int32
+	var failed int32
+	var seedErr error
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for _, i := range items {
+			if atomic.LoadInt32(&failed) == 1 {
+				return
+			}
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for w := 0; w < p.seedWorkers; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range indexes {
+				if atomic.LoadInt32(&failed) == 1 {
+					continue
+				}
+				if err := p.seedDurabilityItem(ctx, i, payload, pacer, retryAfter); err != nil {
+					if atomic.CompareAndSwapInt32(&failed, 0, 1) {
+						seedErr = err
+					}
+					continue
+				}
+				probeSeedRate.WithLabelValues(p.name).Set(pacer.succeeded())
+				count := int(atomic.AddInt32(&written, 1))
+				if count%100 == 0 || count == total {
+					percent, rate, eta := seedProgress(count, total, time.Since(start))
+					// Only the lines crossing a 10% step are logged at info level
+					level := DebugLevel
+					if count == total || count*10/total != (count-100)*10/total {
+						level = InfoLevel
+					}
+					p.log(level, "Seeding durability bucket", Fields{"written": count, "total": total,
+						"percent": percent, "rate": fmt.Sprintf("%.1f/s", rate), "eta": eta})
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	if seedErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return seedErr
+}
+
+// seedProgress returns the percentage of the items written, the average write rate (in objects
+// per second) and the estimated time left to write the remaining items
+func seedProgress(written int, total int, elapsed time.Duration) (int, float64, time.Duration) {
+	percent := written * 100 / total
+	if written <= 0 || elapsed <= 0 {
+		return percent, 0, 0
+	}
+	rate := float64(written) / elapsed.Seconds()
+	eta := time.Duration(float64(total-written) / rate * float64(time.Second)).Round(time.Second)
+	return percent, rate, eta
+}
+
+// seedDurabilityItem writes one durability item, failed writes are retried up to seedMaxRetries
+// times: throttled writes slow down the pacer while other errors are retried with an exponential backoff.
+// Every write reads the payload with a new reader as a failed write may have consumed the previous one.
+// The writes are not retried once the context is done
+func (p *Probe) seedDurabilityItem(ctx context.Context, i int, payload []byte, pacer *seedPacer, retryAfter *retryAfterGate) error {
+	objectName := durabilityObjectName(i)
+	objectSize := int64(len(payload))
+	backoff := newRetryBackoff(p.seedRetryMinDelay, p.seedRetryMaxDelay)
+	if err := pacer.wait(ctx); err != nil {
+		return err
+	}
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.durabilityBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+
+	for retries := 0; err != nil; retries++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if retries >= p.seedMaxRetries {
+			return fmt.Errorf("Seeding of %s failed after %d retries: %s", objectName, retries, err)
+		}
+		probeSeedRetries.WithLabelValues(p.name).Inc()
+		if isThrottlingError(err) && retryAfter.active() {
+			// The next write waits for the Retry-After asked by the endpoint
+			p.log(DebugLevel, "Seeding throttled, retrying after the delay asked by the endpoint", Fields{"item": i, "error": err, "delay": retryAfter.delay()})
+		} else if isThrottlingError(err) {
+			delay := pacer.throttled()
+			p.log(DebugLevel, "Seeding throttled, slowing down", Fields{"item": i, "error": err, "delay": delay})
+		} else {
+			delay := backoff.next()
+			p.log(InfoLevel, "Seeding failed, retrying", Fields{"item": i, "error": err, "delay": delay})
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+		}
+		if err := pacer.wait(ctx); err != nil {
+			return err
+		}
+		_, err = p.endpoint.s3Client.PutObject(ctx, p.durabilityBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+	}
+	s3BytesUploaded.WithLabelValues("durability_seed", p.name).Add(float64(objectSize))
+	return nil
+}
+
+// sampleDurabilityItems reads a random sample of the durability items. Missing items (NoSuchKey)
+// are the durability failures we want to alert on, so they are reported apart from other errors
+func (p *Probe) sampleDurabilityItems() error {
+	if p.durabilitySampleSize <= 0 {
+		return nil
+	}
+	indexes := rand.Perm(p.durabilityItemTotal)
+	if len(indexes) > p.durabilitySampleSize {
+		indexes = indexes[:p.durabilitySampleSize]
+	}
+
+	missing, unreadable := 0, 0
+	for _, index := range indexes {
+		objectName := durabilityObjectName(index)
+		operation := func(ctx context.Context) error {
+			obj, err := p.endpoint.s3Client.GetObject(ctx, p.durabilityBucketName, objectName, minio.GetObjectOptions{})
+			if err != nil {
+				return err
+			}
+			defer obj.Close()
+			read, err := io.Copy(ioutil.Discard, obj)
+			s3BytesDownloaded.WithLabelValues("durability_get", p.name).Add(float64(read))
+			return err
+		}
+		err := p.mesureOperation("durability_get", p.durabilityBucketName, operation)
+		if err == nil {
+			continue
+		}
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			p.log(WarnLevel, "Durability item is missing", Fields{"object": objectName})
+			missing++
+		} else {
+			unreadable++
+		}
+	}
+
+	s3MissingDurabilityItems.WithLabelValues(p.name).Set(float64(missing))
+	if missing > 0 || unreadable > 0 {
+		return fmt.Errorf("%d/%d sampled durability items are missing and %d unreadable", missing, len(indexes), unreadable)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+const edgeRetryInterval = 100 * time.Millisecond
+
+// performEdgeChecks writes an object on the origin endpoint and reads it twice through the edge
+// endpoint: the first read is expected to be a cache miss (cold) and the second a cache hit (warm)
+func (p *Probe) performEdgeChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	objectData := make([]byte, objectSize)
+	if _, err := rand.Read(objectData); err != nil {
+		return err
+	}
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(objectData), objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("edge_origin_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("edge_origin_remove_object", p.latencyBucketName, operation)
+	}()
+
+	if err := p.waitEdgeVisible(objectName); err != nil {
+		return err
+	}
+	if err := p.edgeGet("cold", objectName, objectData); err != nil {
+		return err
+	}
+	return p.edgeGet("warm", objectName, objectData)
+}
+
+// waitEdgeVisible waits until the object is visible from the edge, which may lag behind the origin.
+// The object is polled with unmeasured HEAD requests so that the expected NoSuchKey answers during
+// the lag are neither failed cold reads nor part of the cold latency
+func (p *Probe) waitEdgeVisible(objectName string) error {
+	deadline := time.Now().Add(p.edgeLagTimeout)
+	for {
+		ctx, cancel := context.WithTimeout(p.ctx, p.latencyTimeout)
+		_, err := p.edgeEndpoint.s3Client.StatObject(ctx, p.latencyBucketName, objectName, minio.StatObjectOptions{})
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" || time.Now().After(deadline) {
+			p.log(InfoLevel, "Object is not visible from the edge", Fields{"edge": p.edgeEndpoint.Name, "object": objectName, "error": err})
+			return err
+		}
+		s3EdgeNotFoundCounter.WithLabelValues(p.name, p.edgeEndpoint.Name).Inc()
+		time.Sleep(edgeRetryInterval)
+	}
+}
+
+func (p *Probe) edgeGet(cacheState string, objectName string, expectedData []byte) error {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(p.ctx, p.latencyTimeout)
+	defer cancel()
+
+	var data []byte
+	obj, err := p.edgeEndpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+	if err == nil {
+		data, err = ioutil.ReadAll(obj)
+		obj.Close()
+	}
+
+	s3EdgeTotalCounter.WithLabelValues(p.name, p.edgeEndpoint.Name, cacheState).Inc()
+	s3EdgeLatencyHistogram.WithLabelValues(p.name, p.edgeEndpoint.Name, cacheState).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		p.log(InfoLevel, "Error while executing operation", Fields{"operation": "edge_get_object", "cache": cacheState, "edge": p.edgeEndpoint.Name, "error": err})
+		return err
+	}
+	if !bytes.Equal(data, expectedData) {
+		p.log(WarnLevel, "Edge served a content different from the origin", Fields{"edge": p.edgeEndpoint.Name, "object": objectName})
+		s3EdgeContentMismatchCounter.WithLabelValues(p.name, p.edgeEndpoint.Name).Inc()
+		return errors.New("Edge content doesn't match the origin")
+	}
+	s3EdgeSuccessCounter.WithLabelValues(p.name, p.edgeEndpoint.Name, cacheState).Inc()
+	return nil
+}
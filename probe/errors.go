@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// classifyError returns the reason of a failed operation: the S3 error code when the
+// endpoint answered, credentials when they couldn't be retrieved, signature_rejected when a
+// presigned URL was refused, otherwise a category of the network error. Endpoints not
+// supporting an operation are reported as NotImplemented even without an error code
+func classifyError(err error) string {
+	var credsError *credentialsError
+	if errors.As(err, &credsError) {
+		return "credentials"
+	}
+	var signatureError *signatureRejectedError
+	if errors.As(err, &signatureError) {
+		return "signature_rejected"
+	}
+	errResponse := minio.ToErrorResponse(err)
+	if errResponse.Code != "" {
+		return errResponse.Code
+	}
+	if errResponse.StatusCode == http.StatusNotImplemented {
+		return "NotImplemented"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return "dns"
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return "timeout"
+	}
+	var opError *net.OpError
+	if errors.As(err, &opError) {
+		return "connection"
+	}
+	return "other"
+}
@@ -0,0 +1,45 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string]error{
+		"AccessDenied":   minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403},
+		"NotImplemented": minio.ErrorResponse{StatusCode: 501},
+		"timeout":        &url.Error{Op: "Put", URL: "http://localhost:9000", Err: context.DeadlineExceeded},
+		"dns":            &url.Error{Op: "Put", URL: "http://unknown:9000", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "unknown"}}},
+		"connection":     &url.Error{Op: "Put", URL: "http://localhost:9000", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+		"other":          errors.New("unexpected"),
+	}
+	for reason, err := range cases {
+		if classified := classifyError(err); classified != reason {
+			t.Errorf("Expected %s for %v got %s", reason, err, classified)
+		}
+	}
+}
+
+func TestFailedOperationIsCountedByReason(t *testing.T) {
+	// Buckets are not prepared so the put fails with NoSuchBucket
+	probe := getMemoryTestProbe("request-errors")
+	operation := func(ctx context.Context) error {
+		_, err := probe.endpoint.s3Client.PutObject(ctx, probe.latencyBucketName, "object", strings.NewReader(""), 0, minio.PutObjectOptions{})
+		return err
+	}
+	probe.mesureOperation("put_object", probe.latencyBucketName, operation)
+
+	metric := &io_prometheus_client.Metric{}
+	s3RequestErrors.WithLabelValues("put_object", "request-errors", probe.latencyBucketName, "NoSuchBucket").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 NoSuchBucket error got %f", *metric.Counter.Value)
+	}
+}
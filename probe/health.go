@@ -0,0 +1,38 @@
+package probe
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// NewHealthHandler returns a handler answering 200 when the check passes and 503 otherwise
+func NewHealthHandler(check func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !check() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// IsAlive returns true while StartProbing is running
+func (p *Probe) IsAlive() bool {
+	return atomic.LoadInt32(&p.running) == 1
+}
+
+// IsReady returns true when the probe is running and reports all its metrics: the initial
+// seeding of the durability bucket is done (gateway probes have no durability bucket)
+func (p *Probe) IsReady() bool {
+	return p.IsAlive() && (p.gateway || p.isDurabilityReady())
+}
+
+// LivenessHandler reports if the probe is running
+func (p *Probe) LivenessHandler() http.Handler {
+	return NewHealthHandler(p.IsAlive)
+}
+
+// ReadinessHandler reports if the probe is running and done seeding the durability bucket
+func (p *Probe) ReadinessHandler() http.Handler {
+	return NewHealthHandler(p.IsReady)
+}
@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func healthStatus(handler http.Handler) int {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	return recorder.Code
+}
+
+func TestHealthHandlersFollowProbeState(t *testing.T) {
+	probe := getMemoryTestProbe("health")
+	if status := healthStatus(probe.LivenessHandler()); status != http.StatusServiceUnavailable {
+		t.Errorf("Probe should not be alive before probing got %d", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- probe.StartProbing(ctx)
+	}()
+	for i := 0; i < 100 && !probe.IsAlive(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := healthStatus(probe.LivenessHandler()); status != http.StatusOK {
+		t.Errorf("Probe should be alive while probing got %d", status)
+	}
+	if status := healthStatus(probe.ReadinessHandler()); status != http.StatusServiceUnavailable {
+		t.Errorf("Probe should not be ready before seeding got %d", status)
+	}
+
+	probe.setDurabilityReady()
+	if status := healthStatus(probe.ReadinessHandler()); status != http.StatusOK {
+		t.Errorf("Probe should be ready once seeded got %d", status)
+	}
+
+	cancel()
+	<-done
+	if status := healthStatus(probe.LivenessHandler()); status != http.StatusServiceUnavailable {
+		t.Errorf("Probe should not be alive once stopped got %d", status)
+	}
+}
@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+// Levels of the log messages, from the most verbose
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{DebugLevel: "debug", InfoLevel: "info", WarnLevel: "warn", ErrorLevel: "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of its name (debug, info, warn or error)
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("Unknown log level: %s (must be debug, info, warn or error)", name)
+}
+
+// Fields are the key/value pairs attached to a log message (e.g. endpoint, operation, error)
+type Fields map[string]interface{}
+
+// Logger logs the messages of the probes, messages below the level of the logger are dropped
+type Logger interface {
+	Log(level Level, msg string, fields Fields)
+}
+
+// textLogger logs messages as text lines with the standard log package format
+type textLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// NewTextLogger creates a logger writing text lines (message then key=value fields) to the writer
+func NewTextLogger(w io.Writer, level Level) Logger {
+	return &textLogger{logger: log.New(w, "", log.LstdFlags), level: level}
+}
+
+func (l *textLogger) Log(level Level, msg string, fields Fields) {
+	if level < l.level {
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var line strings.Builder
+	line.WriteString(strings.ToUpper(level.String()))
+	line.WriteString(" ")
+	line.WriteString(msg)
+	for _, key := range keys {
+		fmt.Fprintf(&line, " %s=%q", key, fmt.Sprint(fields[key]))
+	}
+	l.logger.Println(line.String())
+}
+
+// jsonLogger logs messages as JSON objects, one per line
+type jsonLogger struct {
+	mutex sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// NewJSONLogger creates a logger writing JSON objects (time, level, msg and the fields) to the writer
+func NewJSONLogger(w io.Writer, level Level) Logger {
+	return &jsonLogger{w: w, level: level}
+}
+
+func (l *jsonLogger) Log(level Level, msg string, fields Fields) {
+	if level < l.level {
+		return
+	}
+	entry := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		// Errors have no exported fields and would be encoded as {}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg, "error": err.Error()})
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.w.Write(append(line, '\n'))
+}
+
+// NewLogger creates a logger writing to the writer in the format (text or json)
+func NewLogger(w io.Writer, format string, levelName string) (Logger, error) {
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "text":
+		return NewTextLogger(w, level), nil
+	case "json":
+		return NewJSONLogger(w, level), nil
+	}
+	return nil, fmt.Errorf("Unknown log format: %s (must be text or json)", format)
+}
+
+// SetLogger replaces the logger of the probe
+func (p *Probe) SetLogger(logger Logger) {
+	p.logger = logger
+}
+
+// log logs a message of the probe, the endpoint is added to the fields
+func (p *Probe) log(level Level, msg string, fields Fields) {
+	if fields == nil {
+		fields = Fields{}
+	}
+	fields["endpoint"] = p.name
+	p.logger.Log(level, msg, fields)
+}
@@ -0,0 +1,67 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+func TestJSONLoggerWritesFields(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewJSONLogger(&output, InfoLevel)
+	logger.Log(DebugLevel, "dropped", nil)
+	logger.Log(WarnLevel, "Error while executing operation", Fields{"operation": "put_object", "error": errors.New("failure")})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line got %d: %s", len(lines), output.String())
+	}
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Invalid JSON log line %s: %s", lines[0], err)
+	}
+	expected := map[string]string{"level": "warn", "msg": "Error while executing operation", "operation": "put_object", "error": "failure"}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s=%s got %v", key, value, entry[key])
+		}
+	}
+}
+
+func TestTextLoggerWritesFields(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewTextLogger(&output, DebugLevel)
+	logger.Log(InfoLevel, "Probe created", Fields{"endpoint": "s3", "address": "localhost:9000"})
+	if line := output.String(); !strings.HasSuffix(line, `INFO Probe created address="localhost:9000" endpoint="s3"`+"\n") {
+		t.Errorf("Unexpected text log line: %s", line)
+	}
+}
+
+func TestNewProbeFailsWithInvalidLogConfig(t *testing.T) {
+	for _, option := range []string{"format", "level"} {
+		testConfig := config.GetTestConfig()
+		invalid := "invalid"
+		if option == "format" {
+			testConfig.LogFormat = &invalid
+		} else {
+			testConfig.LogLevel = &invalid
+		}
+		if _, err := NewProbe(S3Service{Name: "invalid-log"}, "invalid-log", []S3Endpoint{}, &testConfig); err == nil {
+			t.Errorf("Probe creation should fail with an invalid log %s", option)
+		}
+	}
+}
+
+func TestProbeLogsWithItsLogger(t *testing.T) {
+	var output bytes.Buffer
+	probe := getMemoryTestProbe("logger")
+	probe.SetLogger(NewJSONLogger(&output, DebugLevel))
+	probe.prepareLatencyBucket()
+	if !strings.Contains(output.String(), `"endpoint":"logger"`) {
+		t.Errorf("Expected the endpoint in the probe logs got %s", output.String())
+	}
+}
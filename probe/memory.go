@@ -0,0 +1,433 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+var memoryS3ClientsMutex sync.Mutex
+var memoryS3Clients = map[string]*MemoryS3Client{}
+
+// getMemoryS3Client returns the in-memory backend of the endpoint, probes of the
+// same endpoint share their buckets like they would on a real endpoint
+func getMemoryS3Client(endpoint string) *MemoryS3Client {
+	memoryS3ClientsMutex.Lock()
+	defer memoryS3ClientsMutex.Unlock()
+	client, ok := memoryS3Clients[endpoint]
+	if !ok {
+		client = NewMemoryS3Client()
+		memoryS3Clients[endpoint] = client
+	}
+	return client
+}
+
+// MemoryS3Client is an in-memory S3Client to run the probe without any S3 endpoint.
+// It supports buckets, objects and copies, lifecycle configurations are accepted but ignored
+// and versioning, object lock and multipart uploads are not implemented
+type MemoryS3Client struct {
+	mutex   sync.RWMutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	creationDate time.Time
+	objects      map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info minio.ObjectInfo
+	tags map[string]string
+}
+
+// NewMemoryS3Client creates an empty in-memory S3 backend
+func NewMemoryS3Client() *MemoryS3Client {
+	return &MemoryS3Client{buckets: map[string]*memoryBucket{}}
+}
+
+func memoryError(code string, statusCode int, bucketName, objectName string) error {
+	return minio.ErrorResponse{
+		Code:       code,
+		Message:    code,
+		BucketName: bucketName,
+		Key:        objectName,
+		StatusCode: statusCode,
+	}
+}
+
+func memoryNotImplemented(operation string) error {
+	return minio.ErrorResponse{
+		Code:       "NotImplemented",
+		Message:    fmt.Sprintf("%s is not implemented by the in-memory backend", operation),
+		StatusCode: http.StatusNotImplemented,
+	}
+}
+
+// getBucket must be called with the mutex held
+func (c *MemoryS3Client) getBucket(bucketName string) (*memoryBucket, error) {
+	bucket, ok := c.buckets[bucketName]
+	if !ok {
+		return nil, memoryError("NoSuchBucket", http.StatusNotFound, bucketName, "")
+	}
+	return bucket, nil
+}
+
+// ListBuckets lists the buckets sorted by name
+func (c *MemoryS3Client) ListBuckets(ctx context.Context) ([]minio.BucketInfo, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	buckets := []minio.BucketInfo{}
+	for name, bucket := range c.buckets {
+		buckets = append(buckets, minio.BucketInfo{Name: name, CreationDate: bucket.creationDate})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+// BucketExists checks if the bucket exists
+func (c *MemoryS3Client) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	if err := s3utils.CheckValidBucketName(bucketName); err != nil {
+		return false, err
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	_, ok := c.buckets[bucketName]
+	return ok, nil
+}
+
+// MakeBucket creates the bucket, object locking is not supported
+func (c *MemoryS3Client) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	if err := s3utils.CheckValidBucketName(bucketName); err != nil {
+		return err
+	}
+	if opts.ObjectLocking {
+		return memoryNotImplemented("Object lock")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.buckets[bucketName]; ok {
+		return memoryError("BucketAlreadyOwnedByYou", http.StatusConflict, bucketName, "")
+	}
+	c.buckets[bucketName] = &memoryBucket{creationDate: time.Now().UTC(), objects: map[string]memoryObject{}}
+	return nil
+}
+
+// RemoveBucket removes an empty bucket
+func (c *MemoryS3Client) RemoveBucket(ctx context.Context, bucketName string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bucket, err := c.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	if len(bucket.objects) > 0 {
+		return memoryError("BucketNotEmpty", http.StatusConflict, bucketName, "")
+	}
+	delete(c.buckets, bucketName)
+	return nil
+}
+
+// SetBucketLifecycle accepts the lifecycle configuration of an existing bucket but never expires objects
+func (c *MemoryS3Client) SetBucketLifecycle(ctx context.Context, bucketName string, config *lifecycle.Configuration) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	_, err := c.getBucket(bucketName)
+	return err
+}
+
+// EnableVersioning is not implemented
+func (c *MemoryS3Client) EnableVersioning(ctx context.Context, bucketName string) error {
+	return memoryNotImplemented("Versioning")
+}
+
+// GetObjectLockConfig is not implemented
+func (c *MemoryS3Client) GetObjectLockConfig(ctx context.Context, bucketName string) (string, *minio.RetentionMode, *uint, *minio.ValidityUnit, error) {
+	return "", nil, nil, nil, memoryNotImplemented("Object lock")
+}
+
+// ListObjects lists the objects of the bucket sorted by key. Objects are grouped by
+// common prefixes unless the listing is recursive
+func (c *MemoryS3Client) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	infos := []minio.ObjectInfo{}
+	bucket, err := c.getBucket(bucketName)
+	if err != nil {
+		infos = append(infos, minio.ObjectInfo{Err: err})
+	} else {
+		prefixes := map[string]bool{}
+		for key, object := range bucket.objects {
+			if !strings.HasPrefix(key, opts.Prefix) {
+				continue
+			}
+			if !opts.Recursive {
+				if index := strings.Index(key[len(opts.Prefix):], "/"); index >= 0 {
+					prefixes[key[:len(opts.Prefix)+index+1]] = true
+					continue
+				}
+			}
+			info := object.info
+			if opts.WithVersions {
+				info.VersionID = "null"
+				info.IsLatest = true
+			}
+			infos = append(infos, info)
+		}
+		for prefix := range prefixes {
+			infos = append(infos, minio.ObjectInfo{Key: prefix})
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	}
+
+	objectCh := make(chan minio.ObjectInfo, len(infos))
+	for _, info := range infos {
+		objectCh <- info
+	}
+	close(objectCh)
+	return objectCh
+}
+
+// PutObject stores the whole content of the reader
+func (c *MemoryS3Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return c.PutObjectWithMD5(ctx, bucketName, objectName, reader, objectSize, "", opts)
+}
+
+// PutObjectWithMD5 stores the whole content of the reader, the upload is rejected
+// with a BadDigest error if the content doesn't match the given MD5
+func (c *MemoryS3Client) PutObjectWithMD5(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, md5Base64 string, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	// Like minio, seekable readers supporting ReadAt are read from their current offset
+	// with ReadAt, which doesn't move the offset for the next uploads
+	readerAt, isReaderAt := reader.(io.ReaderAt)
+	seeker, isSeeker := reader.(io.Seeker)
+	if isReaderAt && isSeeker && objectSize >= 0 {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return minio.UploadInfo{}, err
+		}
+		reader = io.NewSectionReader(readerAt, offset, objectSize)
+	} else if objectSize >= 0 {
+		reader = io.LimitReader(reader, objectSize)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	if objectSize >= 0 && int64(len(data)) != objectSize {
+		return minio.UploadInfo{}, memoryError("IncompleteBody", http.StatusBadRequest, bucketName, objectName)
+	}
+	digest := md5.Sum(data)
+	if md5Base64 != "" && md5Base64 != base64.StdEncoding.EncodeToString(digest[:]) {
+		return minio.UploadInfo{}, memoryError("BadDigest", http.StatusBadRequest, bucketName, objectName)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bucket, err := c.getBucket(bucketName)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	info := minio.ObjectInfo{
+		Key:          objectName,
+		ETag:         hex.EncodeToString(digest[:]),
+		Size:         int64(len(data)),
+		LastModified: time.Now().UTC(),
+		ContentType:  opts.ContentType,
+	}
+	bucket.objects[objectName] = memoryObject{data: data, info: info}
+	return minio.UploadInfo{
+		Bucket:       bucketName,
+		Key:          objectName,
+		ETag:         info.ETag,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// GetObject returns the object content, honoring the range set in the options
+func (c *MemoryS3Client) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error) {
+	object, err := c.getObject(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	data := object.data
+	if rangeHeader := opts.Header().Get("Range"); rangeHeader != "" {
+		var start, end int64
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, memoryNotImplemented("Range " + rangeHeader)
+		}
+		if start >= int64(len(data)) || start > end {
+			return nil, memoryError("InvalidRange", http.StatusRequestedRangeNotSatisfiable, bucketName, objectName)
+		}
+		if end >= int64(len(data)) {
+			end = int64(len(data)) - 1
+		}
+		data = data[start : end+1]
+	}
+	return &memoryObjectReader{Reader: bytes.NewReader(data), info: object.info}, nil
+}
+
+// StatObject returns the object metadata
+func (c *MemoryS3Client) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	object, err := c.getObject(bucketName, objectName)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return object.info, nil
+}
+
+func (c *MemoryS3Client) getObject(bucketName, objectName string) (memoryObject, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	bucket, err := c.getBucket(bucketName)
+	if err != nil {
+		return memoryObject{}, err
+	}
+	object, ok := bucket.objects[objectName]
+	if !ok {
+		return memoryObject{}, memoryError("NoSuchKey", http.StatusNotFound, bucketName, objectName)
+	}
+	return object, nil
+}
+
+// RemoveObject removes the object, removing a missing object is not an error
+func (c *MemoryS3Client) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bucket, err := c.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	delete(bucket.objects, objectName)
+	return nil
+}
+
+// RemoveObjects removes the objects received on the channel, missing objects are not an error
+func (c *MemoryS3Client) RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	errorCh := make(chan minio.RemoveObjectError)
+	go func() {
+		defer close(errorCh)
+		for object := range objectsCh {
+			if err := c.RemoveObject(ctx, bucketName, object.Key, minio.RemoveObjectOptions{}); err != nil {
+				errorCh <- minio.RemoveObjectError{ObjectName: object.Key, Err: err}
+			}
+		}
+	}()
+	return errorCh
+}
+
+// CopyObject copies the content of the source object to the destination object
+func (c *MemoryS3Client) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	object, err := c.getObject(src.Bucket, src.Object)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bucket, err := c.getBucket(dst.Bucket)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	info := object.info
+	info.Key = dst.Object
+	info.LastModified = time.Now().UTC()
+	bucket.objects[dst.Object] = memoryObject{data: object.data, info: info, tags: object.tags}
+	return minio.UploadInfo{
+		Bucket:       dst.Bucket,
+		Key:          dst.Object,
+		ETag:         info.ETag,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// PutObjectTagging replaces the tags of the object
+func (c *MemoryS3Client) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bucket, err := c.getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	object, ok := bucket.objects[objectName]
+	if !ok {
+		return memoryError("NoSuchKey", http.StatusNotFound, bucketName, objectName)
+	}
+	object.tags = otags.ToMap()
+	bucket.objects[objectName] = object
+	return nil
+}
+
+// GetObjectTagging returns the tags of the object
+func (c *MemoryS3Client) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+	object, err := c.getObject(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	return tags.MapToObjectTags(object.tags)
+}
+
+// PresignedGetObject is not implemented, the in-memory backend can't be reached over HTTP
+func (c *MemoryS3Client) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	return nil, memoryNotImplemented("Presigned URL")
+}
+
+// NewMultipartUpload is not implemented
+func (c *MemoryS3Client) NewMultipartUpload(ctx context.Context, bucketName, objectName string, opts minio.PutObjectOptions) (string, error) {
+	return "", memoryNotImplemented("Multipart upload")
+}
+
+// PutObjectPart is not implemented
+func (c *MemoryS3Client) PutObjectPart(ctx context.Context, bucketName, objectName, uploadID string, partID int, reader io.Reader, size int64) (minio.ObjectPart, error) {
+	return minio.ObjectPart{}, memoryNotImplemented("Multipart upload")
+}
+
+// ListObjectParts is not implemented
+func (c *MemoryS3Client) ListObjectParts(ctx context.Context, bucketName, objectName, uploadID string, partNumberMarker int, maxParts int) (minio.ListObjectPartsResult, error) {
+	return minio.ListObjectPartsResult{}, memoryNotImplemented("Multipart upload")
+}
+
+// CompleteMultipartUpload is not implemented
+func (c *MemoryS3Client) CompleteMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string, parts []minio.CompletePart) (string, error) {
+	return "", memoryNotImplemented("Multipart upload")
+}
+
+// AbortMultipartUpload is not implemented
+func (c *MemoryS3Client) AbortMultipartUpload(ctx context.Context, bucketName, objectName, uploadID string) error {
+	return memoryNotImplemented("Multipart upload")
+}
+
+// ListMultipartUploads always returns an empty list as multipart uploads are not implemented
+func (c *MemoryS3Client) ListMultipartUploads(ctx context.Context, bucketName, prefix string, maxUploads int) (minio.ListMultipartUploadsResult, error) {
+	return minio.ListMultipartUploadsResult{Bucket: bucketName, Prefix: prefix}, nil
+}
+
+type memoryObjectReader struct {
+	*bytes.Reader
+	info minio.ObjectInfo
+}
+
+func (o *memoryObjectReader) Stat() (minio.ObjectInfo, error) {
+	return o.info, nil
+}
+
+func (o *memoryObjectReader) Close() error {
+	return nil
+}
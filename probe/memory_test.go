@@ -0,0 +1,148 @@
+package probe
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/config"
+	minio "github.com/minio/minio-go/v7"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func getMemoryTestProbe(name string) Probe {
+	testConfig := config.GetTestConfig()
+	backend := "memory"
+	testConfig.Backend = &backend
+	probe, err := NewProbe(S3Service{Name: name}, name, []S3Endpoint{}, &testConfig)
+	if err != nil {
+		log.Fatalf("Error while creating test env: %s", err)
+	}
+	return probe
+}
+
+func TestMemoryS3ClientObjects(t *testing.T) {
+	client := NewMemoryS3Client()
+	ctx := context.Background()
+
+	_, err := client.PutObject(ctx, "my-bucket", "my-object", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	if minio.ToErrorResponse(err).Code != "NoSuchBucket" {
+		t.Errorf("Expected NoSuchBucket got %v", err)
+	}
+
+	if err = client.MakeBucket(ctx, "my-bucket", minio.MakeBucketOptions{}); err != nil {
+		t.Errorf("Bucket creation failed: %s", err)
+	}
+	err = client.MakeBucket(ctx, "my-bucket", minio.MakeBucketOptions{})
+	if minio.ToErrorResponse(err).Code != "BucketAlreadyOwnedByYou" {
+		t.Errorf("Expected BucketAlreadyOwnedByYou got %v", err)
+	}
+	exists, _ := client.BucketExists(ctx, "my-bucket")
+	if !exists {
+		t.Errorf("Bucket should exist")
+	}
+
+	if _, err = client.PutObject(ctx, "my-bucket", "my-object", strings.NewReader("data"), 4, minio.PutObjectOptions{}); err != nil {
+		t.Errorf("Put failed: %s", err)
+	}
+	opts := minio.GetObjectOptions{}
+	opts.SetRange(1, 2)
+	obj, err := client.GetObject(ctx, "my-bucket", "my-object", opts)
+	if err != nil {
+		t.Errorf("Get failed: %s", err)
+	}
+	data, _ := ioutil.ReadAll(obj)
+	if string(data) != "at" {
+		t.Errorf("Expected at got %s", data)
+	}
+
+	if err = client.RemoveObject(ctx, "my-bucket", "my-object", minio.RemoveObjectOptions{}); err != nil {
+		t.Errorf("Remove failed: %s", err)
+	}
+	_, err = client.StatObject(ctx, "my-bucket", "my-object", minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		t.Errorf("Expected NoSuchKey got %v", err)
+	}
+}
+
+func TestMemoryS3ClientListObjects(t *testing.T) {
+	client := NewMemoryS3Client()
+	ctx := context.Background()
+	client.MakeBucket(ctx, "my-bucket", minio.MakeBucketOptions{})
+	for _, key := range []string{"b", "a", "dir/c"} {
+		client.PutObject(ctx, "my-bucket", key, strings.NewReader(""), 0, minio.PutObjectOptions{})
+	}
+
+	keys := []string{}
+	for object := range client.ListObjects(ctx, "my-bucket", minio.ListObjectsOptions{}) {
+		keys = append(keys, object.Key)
+	}
+	if strings.Join(keys, ",") != "a,b,dir/" {
+		t.Errorf("Expected a,b,dir/ got %v", keys)
+	}
+
+	keys = []string{}
+	for object := range client.ListObjects(ctx, "my-bucket", minio.ListObjectsOptions{Recursive: true, Prefix: "dir/"}) {
+		keys = append(keys, object.Key)
+	}
+	if strings.Join(keys, ",") != "dir/c" {
+		t.Errorf("Expected dir/c got %v", keys)
+	}
+
+	for object := range client.ListObjects(ctx, "other-bucket", minio.ListObjectsOptions{}) {
+		if minio.ToErrorResponse(object.Err).Code != "NoSuchBucket" {
+			t.Errorf("Expected NoSuchBucket got %v", object.Err)
+		}
+	}
+}
+
+func TestMemoryS3ClientRejectsBadDigest(t *testing.T) {
+	client := NewMemoryS3Client()
+	ctx := context.Background()
+	client.MakeBucket(ctx, "my-bucket", minio.MakeBucketOptions{})
+	_, err := client.PutObjectWithMD5(ctx, "my-bucket", "my-object", strings.NewReader("data"), 4, "AAAAAAAAAAAAAAAAAAAAAA==", minio.PutObjectOptions{})
+	if minio.ToErrorResponse(err).Code != "BadDigest" {
+		t.Errorf("Expected BadDigest got %v", err)
+	}
+}
+
+func TestMemoryBackendProbeChecks(t *testing.T) {
+	probe := getMemoryTestProbe("memory-checks")
+	probe.contentMD5Probe = true
+	if err := probe.PrepareProbing(context.Background()); err != nil {
+		t.Errorf("Probe preparation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err != nil {
+		t.Errorf("Latency check failed: %s", err)
+	}
+	if err := probe.performDurabilityChecks(); err != nil {
+		t.Errorf("Durability check failed: %s", err)
+	}
+	if err := probe.performContentMD5Checks(); err != nil {
+		t.Errorf("Content-MD5 check failed: %s", err)
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3FoundDurabilityItems.WithLabelValues("memory-checks").Write(metric)
+	if *metric.Gauge.Value != float64(probe.durabilityItemTotal) {
+		t.Errorf("Expected %d objects got %f", probe.durabilityItemTotal, *metric.Gauge.Value)
+	}
+}
+
+func TestMemoryBackendProbeLoop(t *testing.T) {
+	probe := getMemoryTestProbe("memory-loop")
+	if err := probe.PrepareProbing(context.Background()); err != nil {
+		t.Errorf("Probe preparation failed: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	probe.StartProbing(ctx)
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("put_object", "memory-loop", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value == 0 {
+		t.Errorf("No successful put_object recorded by the probe loop")
+	}
+}
@@ -0,0 +1,105 @@
+package probe
+
+import (
+	"github.com/criteo/s3-probe/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// probeMetrics holds the metrics recorded for every probe: the latency, request, error and timeout
+// metrics of its operations, its configuration and the readiness of its durability bucket. The
+// metrics of the opt-in checks remain in the default registry
+type probeMetrics struct {
+	latencySummary    *prometheus.SummaryVec
+	latencyHistogram  *prometheus.HistogramVec
+	totalCounter      *prometheus.CounterVec
+	successCounter    *prometheus.CounterVec
+	requestErrors     *prometheus.CounterVec
+	operationTimeouts *prometheus.CounterVec
+	probeInfo         *prometheus.GaugeVec
+	durabilityReady   *prometheus.GaugeVec
+}
+
+// defaultProbeMetrics returns the package level metrics, registered in the default registry
+func defaultProbeMetrics() probeMetrics {
+	return probeMetrics{
+		latencySummary:    s3LatencySummary,
+		latencyHistogram:  s3LatencyHistogram,
+		totalCounter:      s3TotalCounter,
+		successCounter:    s3SuccessCounter,
+		requestErrors:     s3RequestErrors,
+		operationTimeouts: s3OperationTimeouts,
+		probeInfo:         s3ProbeInfo,
+		durabilityReady:   s3DurabilityReady,
+	}
+}
+
+// newProbeMetrics creates the metrics and registers them in the registerer, the
+// metrics already registered by another probe in the same registerer are shared
+func newProbeMetrics(registerer prometheus.Registerer) (probeMetrics, error) {
+	latencySummary, err := register(registerer, prometheus.NewSummaryVec(latencySummaryOpts, []string{"operation", "endpoint", "bucket", "size"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	latencyHistogram, err := register(registerer, prometheus.NewHistogramVec(newLatencyHistogramOpts(latencyHistogramBuckets), []string{"operation", "endpoint", "bucket", "size"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	totalCounter, err := register(registerer, prometheus.NewCounterVec(totalCounterOpts, []string{"operation", "endpoint", "bucket"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	successCounter, err := register(registerer, prometheus.NewCounterVec(successCounterOpts, []string{"operation", "endpoint", "bucket"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	requestErrors, err := register(registerer, prometheus.NewCounterVec(requestErrorsOpts, []string{"operation", "endpoint", "bucket", "reason"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	operationTimeouts, err := register(registerer, prometheus.NewCounterVec(operationTimeoutsOpts, []string{"operation", "endpoint", "bucket"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	probeInfo, err := register(registerer, prometheus.NewGaugeVec(probeInfoOpts, probeInfoLabels))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	durabilityReady, err := register(registerer, prometheus.NewGaugeVec(durabilityReadyOpts, []string{"endpoint"}))
+	if err != nil {
+		return probeMetrics{}, err
+	}
+	return probeMetrics{
+		latencySummary:    latencySummary.(*prometheus.SummaryVec),
+		latencyHistogram:  latencyHistogram.(*prometheus.HistogramVec),
+		totalCounter:      totalCounter.(*prometheus.CounterVec),
+		successCounter:    successCounter.(*prometheus.CounterVec),
+		requestErrors:     requestErrors.(*prometheus.CounterVec),
+		operationTimeouts: operationTimeouts.(*prometheus.CounterVec),
+		probeInfo:         probeInfo.(*prometheus.GaugeVec),
+		durabilityReady:   durabilityReady.(*prometheus.GaugeVec),
+	}, nil
+}
+
+// register registers the collector, or returns the collector already registered under the same name
+func register(registerer prometheus.Registerer, collector prometheus.Collector) (prometheus.Collector, error) {
+	if err := registerer.Register(collector); err != nil {
+		if alreadyRegistered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return alreadyRegistered.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return collector, nil
+}
+
+// NewProbeWithRegisterer creates a new S3 probe like NewProbe, the metrics recorded for every probe
+// (s3_latency_seconds, s3_latency_histogram_seconds, s3_request_total, s3_request_success_total,
+// s3_request_errors_total, s3_operation_timeouts_total, s3_probe_info and s3_durability_ready) are
+// registered in the registerer instead of the default registry. The metrics of the opt-in checks
+// (versioning, tagging, edge...), of the seeding and of the connections remain in the default registry
+func NewProbeWithRegisterer(service S3Service, endpoint string, gatewayEndpoints []S3Endpoint, cfg *config.Config, registerer prometheus.Registerer) (Probe, error) {
+	metrics, err := newProbeMetrics(registerer)
+	if err != nil {
+		return Probe{}, err
+	}
+	return newProbe(service, endpoint, gatewayEndpoints, cfg, metrics)
+}
@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/criteo/s3-probe/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newRegisteredMemoryTestProbe(t *testing.T, name string, registerer prometheus.Registerer) Probe {
+	testConfig := config.GetTestConfig()
+	backend := "memory"
+	testConfig.Backend = &backend
+	probe, err := NewProbeWithRegisterer(S3Service{Name: name}, name, []S3Endpoint{}, &testConfig, registerer)
+	if err != nil {
+		t.Fatalf("Error while creating test env: %s", err)
+	}
+	return probe
+}
+
+// requestTotal sums the samples of s3_request_total gathered from the registry
+func requestTotal(t *testing.T, gatherer prometheus.Gatherer) float64 {
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Error while gathering metrics: %s", err)
+	}
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != "s3_request_total" {
+			continue
+		}
+		for _, metric := range family.Metric {
+			total += metric.Counter.GetValue()
+		}
+	}
+	return total
+}
+
+func TestProbesWithRegisterersHaveIsolatedMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	otherRegistry := prometheus.NewRegistry()
+	probe := newRegisteredMemoryTestProbe(t, "registry", registry)
+	newRegisteredMemoryTestProbe(t, "other-registry", otherRegistry)
+
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err != nil {
+		t.Errorf("Latency check failed: %s", err)
+	}
+
+	if total := requestTotal(t, registry); total == 0 {
+		t.Errorf("Expected requests to be recorded in the probe registry")
+	}
+	if total := requestTotal(t, otherRegistry); total != 0 {
+		t.Errorf("Expected no request recorded in the other registry got %f", total)
+	}
+}
+
+func TestProbesWithSameRegistererShareMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	probe := newRegisteredMemoryTestProbe(t, "shared-registry", registry)
+	otherProbe := newRegisteredMemoryTestProbe(t, "other-shared-registry", registry)
+	if probe.metrics.totalCounter != otherProbe.metrics.totalCounter {
+		t.Errorf("Probes registered in the same registry should share their metrics")
+	}
+}
+
+func TestProbeWithRegistererRecordsItsInfoInRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	probe := newRegisteredMemoryTestProbe(t, "registry-info", registry)
+	probe.setDurabilityReady()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Error while gathering metrics: %s", err)
+	}
+	gathered := map[string]bool{}
+	for _, family := range families {
+		gathered[family.GetName()] = true
+	}
+	for _, name := range []string{"s3_probe_info", "s3_durability_ready"} {
+		if !gathered[name] {
+			t.Errorf("Expected %s to be recorded in the probe registry", name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performMultipartChecks uploads an object part by part and reads back its first part. The
+// latency of the whole upload is recorded as multipart_put, apart from the latency of each step
+func (p *Probe) performMultipartChecks() error {
+	objectName := p.randomObjectName()
+	partSize := int64(p.multipartPartSize)
+
+	start := time.Now()
+	err := p.putMultipartObject(objectName, partSize)
+	if err := p.recordOperation("multipart_put", p.latencyBucketName, partSize*int64(p.multipartParts), start, err); err != nil {
+		return err
+	}
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("multipart_remove_object", p.latencyBucketName, operation)
+	}()
+
+	operation := func(ctx context.Context) error {
+		opts := minio.GetObjectOptions{}
+		if err := opts.SetRange(0, partSize-1); err != nil {
+			return err
+		}
+		obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, opts)
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		read, err := io.Copy(ioutil.Discard, obj)
+		if err != nil {
+			return err
+		}
+		if read != partSize {
+			return fmt.Errorf("Expected %d bytes for the first part but read %d", partSize, read)
+		}
+		return nil
+	}
+	return p.mesureOperation("multipart_get_part", p.latencyBucketName, operation)
+}
+
+// putMultipartObject creates a multipart upload, uploads its parts, lists the uploaded parts and
+// completes the upload. Any failure before completion aborts the upload so the probe never leaves
+// billable orphaned uploads behind
+func (p *Probe) putMultipartObject(objectName string, partSize int64) error {
+	var uploadID string
+	operation := func(ctx context.Context) error {
+		var err error
+		uploadID, err = p.endpoint.s3Client.NewMultipartUpload(ctx, p.latencyBucketName, objectName, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("multipart_create", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			p.abortMultipartUpload(objectName, uploadID)
+		}
+	}()
+
+	parts := []minio.CompletePart{}
+	for partNumber := 1; partNumber <= p.multipartParts; partNumber++ {
+		partData, _ := randomObject(partSize)
+		partNumber := partNumber
+		operation = func(ctx context.Context) error {
+			part, err := p.endpoint.s3Client.PutObjectPart(ctx, p.latencyBucketName, objectName, uploadID, partNumber, partData, partSize)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+			return nil
+		}
+		if err := p.mesureOperation("multipart_upload_part", p.latencyBucketName, operation); err != nil {
+			return err
+		}
+	}
+
+	operation = func(ctx context.Context) error {
+		result, err := p.endpoint.s3Client.ListObjectParts(ctx, p.latencyBucketName, objectName, uploadID, 0, len(parts))
+		if err != nil {
+			return err
+		}
+		if len(result.ObjectParts) != len(parts) {
+			return fmt.Errorf("Expected %d uploaded parts but %d were listed", len(parts), len(result.ObjectParts))
+		}
+		return nil
+	}
+	if err := p.mesureOperation("multipart_list_parts", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.CompleteMultipartUpload(ctx, p.latencyBucketName, objectName, uploadID, parts)
+		return err
+	}
+	if err := p.mesureOperation("multipart_complete", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	completed = true
+	return nil
+}
+
+func (p *Probe) abortMultipartUpload(objectName string, uploadID string) {
+	// The upload is aborted even when the probe is terminating
+	ctx, cancel := context.WithTimeout(context.Background(), p.latencyTimeout)
+	defer cancel()
+	err := p.endpoint.s3Client.AbortMultipartUpload(ctx, p.latencyBucketName, objectName, uploadID)
+	if err != nil {
+		p.log(WarnLevel, "Failed to abort multipart upload", Fields{"upload_id": uploadID, "object": objectName, "error": err})
+		return
+	}
+	s3MultipartAbortedCounter.WithLabelValues(p.name).Inc()
+	p.log(DebugLevel, "Aborted multipart upload", Fields{"upload_id": uploadID, "object": objectName})
+}
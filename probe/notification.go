@@ -0,0 +1,167 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// NotificationSink checks the delivery of S3 event notifications. Notification targets
+// (SQS, webhooks...) vary a lot between deployments so sinks are pluggable
+type NotificationSink interface {
+	// WaitForEvent blocks until the creation event of the object is received or the context is done
+	WaitForEvent(ctx context.Context, bucketName string, objectName string) error
+}
+
+var notificationSinksMutex sync.RWMutex
+var notificationSinks = map[string]NotificationSink{}
+
+// RegisterNotificationSink makes a notification sink available to the probes under the given name
+func RegisterNotificationSink(name string, sink NotificationSink) {
+	notificationSinksMutex.Lock()
+	defer notificationSinksMutex.Unlock()
+	notificationSinks[name] = sink
+}
+
+func getNotificationSink(name string) (NotificationSink, bool) {
+	notificationSinksMutex.RLock()
+	defer notificationSinksMutex.RUnlock()
+	sink, ok := notificationSinks[name]
+	return sink, ok
+}
+
+// webhookEventRetention is how long events nobody waited for are kept
+const webhookEventRetention = 10 * time.Minute
+
+// WebhookNotificationSink receives S3 event notifications sent by the endpoint to a webhook served by the probe
+type WebhookNotificationSink struct {
+	mutex    sync.Mutex
+	waiters  map[string]chan struct{}
+	received map[string]time.Time
+	logger   Logger
+}
+
+type webhookEvent struct {
+	Records []struct {
+		S3 struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// NewWebhookNotificationSink creates a notification sink to be served as a webhook target
+func NewWebhookNotificationSink() *WebhookNotificationSink {
+	return &WebhookNotificationSink{
+		waiters:  map[string]chan struct{}{},
+		received: map[string]time.Time{},
+		logger:   NewTextLogger(os.Stderr, InfoLevel),
+	}
+}
+
+// SetLogger replaces the logger of the sink
+func (s *WebhookNotificationSink) SetLogger(logger Logger) {
+	s.logger = logger
+}
+
+// ServeHTTP handles the event notifications posted by the endpoint
+func (s *WebhookNotificationSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	event := webhookEvent{}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		s.logger.Log(WarnLevel, "Invalid event notification received", Fields{"error": err})
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, record := range event.Records {
+		// Object keys are URL encoded in event notifications
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+		s.notify(record.S3.Bucket.Name + "/" + key)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *WebhookNotificationSink) notify(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if waiter, ok := s.waiters[key]; ok {
+		close(waiter)
+		delete(s.waiters, key)
+		return
+	}
+	now := time.Now()
+	for receivedKey, receivedAt := range s.received {
+		if now.Sub(receivedAt) > webhookEventRetention {
+			delete(s.received, receivedKey)
+		}
+	}
+	s.received[key] = now
+}
+
+// WaitForEvent blocks until the webhook receives the event of the object or the context is done
+func (s *WebhookNotificationSink) WaitForEvent(ctx context.Context, bucketName string, objectName string) error {
+	key := bucketName + "/" + objectName
+	s.mutex.Lock()
+	if _, ok := s.received[key]; ok {
+		delete(s.received, key)
+		s.mutex.Unlock()
+		return nil
+	}
+	waiter := make(chan struct{})
+	s.waiters[key] = waiter
+	s.mutex.Unlock()
+
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		delete(s.waiters, key)
+		s.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// performNotificationChecks writes an object and waits for its creation event to be delivered to the sink
+func (p *Probe) performNotificationChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("notification_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("notification_remove_object", p.latencyBucketName, operation)
+	}()
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(p.ctx, p.notificationTimeout)
+	defer cancel()
+	if err := p.notificationSink.WaitForEvent(ctx, p.latencyBucketName, objectName); err != nil {
+		p.log(InfoLevel, "Event notification not delivered", Fields{"object": objectName, "error": err})
+		s3NotificationFailures.WithLabelValues(p.name).Inc()
+		return err
+	}
+	s3NotificationDeliveryHistogram.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+	return nil
+}
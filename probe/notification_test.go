@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const testWebhookEvent = `{"EventName":"s3:ObjectCreated:Put","Key":"my-bucket/my%20object","Records":[
+{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"my-bucket"},"object":{"key":"my%20object"}}}]}`
+
+func TestWebhookNotificationSinkReceivesEventAfterWait(t *testing.T) {
+	sink := NewWebhookNotificationSink()
+	done := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- sink.WaitForEvent(ctx, "my-bucket", "my object")
+	}()
+
+	// Wait for the waiter to be registered before sending the event
+	for {
+		sink.mutex.Lock()
+		registered := len(sink.waiters) == 1
+		sink.mutex.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("POST", "/notifications", strings.NewReader(testWebhookEvent)))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected 200 got %d", recorder.Code)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Event should have been received: %s", err)
+	}
+}
+
+func TestWebhookNotificationSinkReceivesEventBeforeWait(t *testing.T) {
+	sink := NewWebhookNotificationSink()
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("POST", "/notifications", strings.NewReader(testWebhookEvent)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := sink.WaitForEvent(ctx, "my-bucket", "my object"); err != nil {
+		t.Errorf("Event should have been received: %s", err)
+	}
+}
+
+func TestWebhookNotificationSinkTimeout(t *testing.T) {
+	sink := NewWebhookNotificationSink()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sink.WaitForEvent(ctx, "my-bucket", "other-object"); err == nil {
+		t.Errorf("WaitForEvent should fail when no event is received")
+	}
+	if len(sink.waiters) != 0 {
+		t.Errorf("Waiter should be removed after a timeout")
+	}
+}
+
+func TestWebhookNotificationSinkRejectsInvalidEvent(t *testing.T) {
+	var output bytes.Buffer
+	sink := NewWebhookNotificationSink()
+	sink.SetLogger(NewJSONLogger(&output, InfoLevel))
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest("POST", "/notifications", strings.NewReader("not json")))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 got %d", recorder.Code)
+	}
+	if !strings.Contains(output.String(), `"level":"warn"`) {
+		t.Errorf("Invalid event should be logged with the sink logger, got %q", output.String())
+	}
+}
+
+// recordingNotificationSink acknowledges every event and records the objects waited for
+type recordingNotificationSink struct {
+	objectNames []string
+}
+
+func (s *recordingNotificationSink) WaitForEvent(ctx context.Context, bucketName string, objectName string) error {
+	s.objectNames = append(s.objectNames, objectName)
+	return nil
+}
+
+func TestNotificationCheckUsesConfiguredObjectNames(t *testing.T) {
+	probe := getMemoryTestProbe("notification-names")
+	probe.objectNameCharset = "nasty"
+	sink := &recordingNotificationSink{}
+	probe.notificationSink = sink
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performNotificationChecks(); err != nil {
+		t.Errorf("Notification check failed: %s", err)
+	}
+	if len(sink.objectNames) != 1 || utf8.RuneCountInString(sink.objectNames[0]) != probe.objectNameLength {
+		t.Errorf("Expected an object name of %d characters got %q", probe.objectNameLength, sink.objectNames)
+	}
+}
@@ -0,0 +1,102 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+const objectLockRetention = 1 * time.Minute
+
+// prepareObjectLockBucket creates the Object Lock enabled bucket. Endpoints without Object Lock
+// support are not an error: the object lock probe is simply disabled
+func (p *Probe) prepareObjectLockBucket() error {
+	p.log(InfoLevel, "Checking if object lock bucket is present", Fields{"bucket": p.objectLockBucketName})
+	exists, errBucketExists := bucketExists(p.endpoint.s3Client, p.objectLockBucketName)
+	if errBucketExists != nil {
+		return errBucketExists
+	}
+	if !exists {
+		p.log(InfoLevel, "Preparing object lock bucket", Fields{"bucket": p.objectLockBucketName})
+		probeBucketAttempt.WithLabelValues(p.name).Inc()
+
+		_, err := p.makeBucket(p.endpoint.s3Client, p.objectLockBucketName, minio.MakeBucketOptions{ObjectLocking: true})
+		if err != nil {
+			p.log(WarnLevel, "Cannot create an object lock bucket, disabling object lock probe", Fields{"bucket": p.objectLockBucketName, "error": err})
+			p.objectLockProbe = false
+			return nil
+		}
+	}
+
+	objectLock, _, _, _, err := p.endpoint.s3Client.GetObjectLockConfig(context.Background(), p.objectLockBucketName)
+	if err != nil || objectLock != "Enabled" {
+		p.log(WarnLevel, "Object lock is not enabled, disabling object lock probe", Fields{"bucket": p.objectLockBucketName, "error": err})
+		p.objectLockProbe = false
+	}
+	return nil
+}
+
+// performObjectLockChecks writes a governance-locked object and checks that it can only be
+// deleted with the bypass governance header. The locked object is removed with the bypass on
+// every exit path, as the object lock bucket has no lifecycle to clean it up
+func (p *Probe) performObjectLockChecks() (err error) {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+
+	var versionID string
+	operation := func(ctx context.Context) error {
+		info, err := p.endpoint.s3Client.PutObject(ctx, p.objectLockBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{
+			Mode:            minio.Governance,
+			RetainUntilDate: time.Now().Add(objectLockRetention).UTC(),
+		})
+		versionID = info.VersionID
+		return err
+	}
+	if err := p.mesureOperation("locked_put_object", p.objectLockBucketName, operation); err != nil {
+		return err
+	}
+
+	deleted := false
+	defer func() {
+		if deleted {
+			return
+		}
+		operation := func(ctx context.Context) error {
+			err := p.endpoint.s3Client.RemoveObject(ctx, p.objectLockBucketName, objectName, minio.RemoveObjectOptions{VersionID: versionID, GovernanceBypass: true})
+			if err != nil {
+				p.log(WarnLevel, "Governance-locked object couldn't be deleted with bypass", Fields{"object": objectName})
+				s3ObjectLockAnomalies.WithLabelValues(p.name, "bypass_refused").Inc()
+			}
+			return err
+		}
+		if bypassErr := p.mesureOperation("locked_bypass_remove_object", p.objectLockBucketName, operation); err == nil {
+			err = bypassErr
+		}
+	}()
+
+	// A delete of the locked version without the bypass header must be denied
+	operation = func(ctx context.Context) error {
+		err := p.endpoint.s3Client.RemoveObject(ctx, p.objectLockBucketName, objectName, minio.RemoveObjectOptions{VersionID: versionID})
+		if err == nil {
+			p.log(WarnLevel, "Governance-locked object was deleted without bypass", Fields{"object": objectName})
+			s3ObjectLockAnomalies.WithLabelValues(p.name, "unprotected_delete").Inc()
+			deleted = true
+			return nil
+		}
+		if minio.ToErrorResponse(err).Code != "AccessDenied" {
+			s3ObjectLockAnomalies.WithLabelValues(p.name, "unexpected_delete_error").Inc()
+			return err
+		}
+		return nil
+	}
+	if err := p.mesureOperation("locked_remove_object", p.objectLockBucketName, operation); err != nil {
+		return err
+	}
+	if deleted {
+		return errors.New("Governance-locked object was deleted without bypass")
+	}
+	return nil
+}
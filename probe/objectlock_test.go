@@ -0,0 +1,43 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// erroringLockS3Client fails the deletes without the bypass header with an unexpected error
+// and records the deletes done with the bypass
+type erroringLockS3Client struct {
+	*MemoryS3Client
+	bypassRemovals int
+}
+
+func (c *erroringLockS3Client) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	if !opts.GovernanceBypass {
+		return minio.ErrorResponse{Code: "InternalError", StatusCode: 500}
+	}
+	c.bypassRemovals++
+	return c.MemoryS3Client.RemoveObject(ctx, bucketName, objectName, opts)
+}
+
+func TestObjectLockRemovesLockedObjectOnUnexpectedError(t *testing.T) {
+	probe := getMemoryTestProbe("objectlock_cleanup")
+	client := &erroringLockS3Client{MemoryS3Client: NewMemoryS3Client()}
+	probe.endpoint.s3Client = client
+	if err := client.MakeBucket(context.Background(), probe.objectLockBucketName, minio.MakeBucketOptions{}); err != nil {
+		t.Fatalf("Bucket creation failed: %s", err)
+	}
+
+	if err := probe.performObjectLockChecks(); err == nil {
+		t.Errorf("An unexpected delete error should fail the check")
+	}
+	if client.bypassRemovals != 1 {
+		t.Errorf("Locked object should be removed with the bypass once, got %d removals", client.bypassRemovals)
+	}
+	objects := client.ListObjects(context.Background(), probe.objectLockBucketName, minio.ListObjectsOptions{})
+	for object := range objects {
+		t.Errorf("Locked object %s was left behind", object.Key)
+	}
+}
@@ -0,0 +1,81 @@
+package probe
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxObjectNameBytes is the maximum length of an S3 key, in bytes of its UTF-8 encoding
+const maxObjectNameBytes = 1024
+
+const alphanumericCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// objectNameCharsets lists the characters available for each object name charset, the nasty
+// charset stresses URL encoding with reserved, non-ASCII and multi-byte characters
+var objectNameCharsets = map[string][]rune{
+	"hex":          []rune("0123456789abcdef"),
+	"alphanumeric": []rune(alphanumericCharset),
+	"nasty":        []rune(alphanumericCharset + " /+%&=?#:;,@!$'()*[]~<>{}^`|\"éàüß日本語€😀"),
+}
+
+func isValidObjectNameCharset(charset string) bool {
+	_, ok := objectNameCharsets[charset]
+	return ok
+}
+
+// objectNameMaxBytes returns the length in bytes of the longest name of length characters of the charset
+func objectNameMaxBytes(length int, charset string) int {
+	longest := 1
+	for _, r := range objectNameCharsets[charset] {
+		if utf8.RuneLen(r) > longest {
+			longest = utf8.RuneLen(r)
+		}
+	}
+	return length * longest
+}
+
+// randomObjectName generates an object name of length characters picked from the given charset.
+// Names always start and end with an alphanumeric character and never contain consecutive slashes
+// as most endpoints reject or normalize such keys
+func randomObjectName(length int, charset string) (string, error) {
+	runes, ok := objectNameCharsets[charset]
+	if !ok {
+		return "", fmt.Errorf("Unknown object name charset: %s", charset)
+	}
+	alphanumeric := []rune{}
+	for _, r := range runes {
+		if strings.ContainsRune(alphanumericCharset, r) {
+			alphanumeric = append(alphanumeric, r)
+		}
+	}
+
+	name := make([]rune, length)
+	for i := range name {
+		candidates := runes
+		if i == 0 || i == length-1 {
+			candidates = alphanumeric
+		}
+		for {
+			index, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates))))
+			if err != nil {
+				return "", err
+			}
+			name[i] = candidates[index.Int64()]
+			if name[i] != '/' || name[i-1] != '/' {
+				break
+			}
+		}
+	}
+	return string(name), nil
+}
+
+func (p *Probe) randomObjectName() string {
+	objectName, err := randomObjectName(p.objectNameLength, p.objectNameCharset)
+	if err != nil {
+		objectName, _ = randomHex(20)
+	}
+	return objectName
+}
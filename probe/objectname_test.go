@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+func TestRandomObjectNameHasRequestedLength(t *testing.T) {
+	for charset := range objectNameCharsets {
+		name, err := randomObjectName(100, charset)
+		if err != nil {
+			t.Errorf("Object name generation failed for %s: %s", charset, err)
+		}
+		if utf8.RuneCountInString(name) != 100 {
+			t.Errorf("Expected 100 characters for %s got %d", charset, utf8.RuneCountInString(name))
+		}
+	}
+}
+
+func TestRandomObjectNameUsesCharset(t *testing.T) {
+	name, _ := randomObjectName(200, "hex")
+	if strings.Trim(name, "0123456789abcdef") != "" {
+		t.Errorf("Hex object name contains non hex characters: %s", name)
+	}
+}
+
+func TestRandomNastyObjectNameIsWellFormed(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		name, _ := randomObjectName(50, "nasty")
+		if strings.Contains(name, "//") {
+			t.Errorf("Object name contains consecutive slashes: %s", name)
+		}
+		if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+			t.Errorf("Object name starts or ends with a slash: %s", name)
+		}
+	}
+}
+
+func TestRandomObjectNameFailsWithUnknownCharset(t *testing.T) {
+	_, err := randomObjectName(10, "unknown")
+	if err == nil {
+		t.Errorf("Object name generation should fail with an unknown charset")
+	}
+}
+
+func TestNewProbeLimitsObjectNameBytes(t *testing.T) {
+	cfg := config.GetTestConfig()
+	backend := "memory"
+	cfg.Backend = &backend
+	for _, tc := range []struct {
+		charset string
+		length  int
+		valid   bool
+	}{
+		{"hex", 1024, true},
+		{"hex", 1025, false},
+		{"nasty", 256, true},
+		{"nasty", 257, false},
+	} {
+		charset, length := tc.charset, tc.length
+		cfg.ObjectNameCharset = &charset
+		cfg.ObjectNameLength = &length
+		_, err := NewProbe(S3Service{Name: "name-bytes"}, "name-bytes", []S3Endpoint{}, &cfg)
+		if (err == nil) != tc.valid {
+			t.Errorf("Unexpected validation of %d %s characters: %v", length, charset, err)
+		}
+	}
+	if maxBytes := objectNameMaxBytes(256, "nasty"); maxBytes != 1024 {
+		t.Errorf("Expected 1024 bytes for 256 nasty characters got %d", maxBytes)
+	}
+}
@@ -0,0 +1,64 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// onceChecks returns the checks of a single probe cycle: the checks performed on every tick of the
+// probe rate followed by the durability, multipart, overwrite and read-after-write checks enabled
+func (p *Probe) onceChecks() []func() error {
+	checks := p.cycleChecks()
+	if p.gateway {
+		return checks
+	}
+	if p.durabilityProbeRatePerMin > 0 {
+		checks = append(checks, p.performDurabilityChecks)
+		if p.usageFetcher != nil {
+			checks = append(checks, p.performUsageChecks)
+		}
+	}
+	if p.multipartProbeRatePerMin > 0 {
+		checks = append(checks, p.performMultipartChecks)
+	}
+	if p.overwriteProbeRatePerMin > 0 {
+		checks = append(checks, p.performOverwriteChecks)
+	}
+	if p.readAfterWriteRatePerMin > 0 {
+		checks = append(checks, p.performReadAfterWriteChecks)
+	}
+	return checks
+}
+
+// RunOnce prepares the probe then performs a single probe cycle synchronously, for smoke tests
+// and health checks that can't scrape the metrics. The operations are measured as when probing
+// continuously and the returned error aggregates the errors of the failed checks
+func (p *Probe) RunOnce(ctx context.Context) error {
+	p.log(InfoLevel, "Running a single probe cycle", nil)
+	p.ctx = ctx
+	if err := p.PrepareProbing(ctx); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	checks := p.onceChecks()
+	var failures []string
+	for _, check := range checks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := check(); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	s3ProbeCycleDuration.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+	s3ProbeCycles.WithLabelValues(p.name).Inc()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d/%d checks failed: %s", len(failures), len(checks), strings.Join(failures, "; "))
+	}
+	p.log(InfoLevel, "Probe cycle succeeded", Fields{"checks": len(checks)})
+	return nil
+}
@@ -0,0 +1,36 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestRunOnceSucceedsOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("run-once")
+	if err := probe.RunOnce(context.Background()); err != nil {
+		t.Errorf("Probe cycle failed: %s", err)
+	}
+	if !probe.isDurabilityReady() {
+		t.Errorf("Durability bucket should be prepared by the probe cycle")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("put_object", "run-once", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful put_object got %f", *metric.Counter.Value)
+	}
+	s3ProbeCycles.WithLabelValues("run-once").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 probe cycle got %f", *metric.Counter.Value)
+	}
+}
+
+func TestRunOnceReportsFailedChecks(t *testing.T) {
+	probe := getMemoryTestProbe("run-once-failure")
+	probe.endpoint.s3Client = &truncatingStatS3Client{NewMemoryS3Client()}
+	if err := probe.RunOnce(context.Background()); err == nil {
+		t.Errorf("Probe cycle should fail when the stat size doesn't match")
+	}
+}
@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performOverwriteChecks writes the same key over and over to measure the latency of
+// overwrites (churn) against the first write of the key, then checks that the last
+// write wins and removes the key
+func (p *Probe) performOverwriteChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	objectData := make([]byte, objectSize)
+
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("overwrite_remove_object", p.latencyBucketName, operation)
+	}()
+
+	for i := 0; i <= p.overwriteCount; i++ {
+		if _, err := rand.Read(objectData); err != nil {
+			return err
+		}
+		operationName := "overwrite_put_object"
+		if i == 0 {
+			operationName = "overwrite_initial_put_object"
+		}
+		operation := func(ctx context.Context) error {
+			_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(objectData), objectSize, minio.PutObjectOptions{})
+			return err
+		}
+		if err := p.mesureOperation(operationName, p.latencyBucketName, operation); err != nil {
+			return err
+		}
+	}
+
+	operation := func(ctx context.Context) error {
+		obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		data, err := ioutil.ReadAll(obj)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, objectData) {
+			p.log(WarnLevel, "Object doesn't hold the content of its last overwrite", Fields{"object": objectName})
+			s3OverwriteStaleReads.WithLabelValues(p.name).Inc()
+			return errors.New("Read content is not the last written content")
+		}
+		return nil
+	}
+	return p.mesureOperation("overwrite_get_object", p.latencyBucketName, operation)
+}
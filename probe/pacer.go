@@ -0,0 +1,110 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// seedPacer adapts the pace of the durability seeding to the throttling signals of the endpoint.
+// Writes go full speed until the endpoint asks to slow down, the delay between writes is then
+// doubled on each throttled write and halved on each successful one
+type seedPacer struct {
+	mutex     sync.Mutex
+	delay     time.Duration
+	minDelay  time.Duration
+	maxDelay  time.Duration
+	lastWrite time.Time
+}
+
+func newSeedPacer(minDelay time.Duration, maxDelay time.Duration) *seedPacer {
+	return &seedPacer{minDelay: minDelay, maxDelay: maxDelay, lastWrite: time.Now()}
+}
+
+// wait blocks for the current delay between writes or until the context is done
+func (s *seedPacer) wait(ctx context.Context) error {
+	s.mutex.Lock()
+	delay := s.delay
+	s.mutex.Unlock()
+	return sleepContext(ctx, delay)
+}
+
+// throttled slows down the pace after the endpoint rejected a write and returns the new delay
+func (s *seedPacer) throttled() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.delay < s.minDelay {
+		s.delay = s.minDelay
+	} else {
+		s.delay *= 2
+	}
+	if s.delay > s.maxDelay {
+		s.delay = s.maxDelay
+	}
+	return s.delay
+}
+
+// succeeded ramps the pace back up after a successful write and returns
+// the effective write rate (in objects per second)
+func (s *seedPacer) succeeded() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.delay /= 2
+	if s.delay < s.minDelay {
+		s.delay = 0
+	}
+	now := time.Now()
+	elapsed := now.Sub(s.lastWrite)
+	s.lastWrite = now
+	if elapsed <= 0 {
+		return 0
+	}
+	return 1 / elapsed.Seconds()
+}
+
+// retryBackoff computes the delays between the retries of a failed write,
+// starting at minDelay and doubling on each retry up to maxDelay
+type retryBackoff struct {
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+func newRetryBackoff(minDelay time.Duration, maxDelay time.Duration) *retryBackoff {
+	return &retryBackoff{delay: minDelay, maxDelay: maxDelay}
+}
+
+// next returns the delay before the next retry
+func (b *retryBackoff) next() time.Duration {
+	delay := b.delay
+	if delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+	b.delay = delay * 2
+	return delay
+}
+
+// sleepContext blocks for the delay, it returns the error of the context when it is done first
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isThrottlingError returns true when the endpoint asked the client to slow down
+func isThrottlingError(err error) bool {
+	errResponse := minio.ToErrorResponse(err)
+	return errResponse.Code == "SlowDown" ||
+		errResponse.StatusCode == http.StatusServiceUnavailable ||
+		errResponse.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,182 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// failingPutS3Client mimics an unhealthy endpoint rejecting every write
+type failingPutS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *failingPutS3Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return minio.UploadInfo{}, minio.ErrorResponse{Code: "InternalError", StatusCode: 500}
+}
+
+func TestSeedPacerSlowsDownWhenThrottled(t *testing.T) {
+	pacer := newSeedPacer(100*time.Millisecond, 1*time.Second)
+	if pacer.delay != 0 {
+		t.Errorf("Seeding should start at full speed")
+	}
+
+	pacer.throttled()
+	if pacer.delay != 100*time.Millisecond {
+		t.Errorf("Expected 100ms delay got %s", pacer.delay)
+	}
+
+	pacer.throttled()
+	if pacer.delay != 200*time.Millisecond {
+		t.Errorf("Expected 200ms delay got %s", pacer.delay)
+	}
+
+	for i := 0; i < 10; i++ {
+		pacer.throttled()
+	}
+	if pacer.delay != 1*time.Second {
+		t.Errorf("Delay should be capped to 1s got %s", pacer.delay)
+	}
+}
+
+func TestSeedPacerRampsUpOnSuccess(t *testing.T) {
+	pacer := newSeedPacer(100*time.Millisecond, 1*time.Second)
+	pacer.delay = 400 * time.Millisecond
+
+	pacer.succeeded()
+	if pacer.delay != 200*time.Millisecond {
+		t.Errorf("Expected 200ms delay got %s", pacer.delay)
+	}
+
+	pacer.succeeded()
+	pacer.succeeded()
+	if pacer.delay != 0 {
+		t.Errorf("Seeding should be back at full speed got %s", pacer.delay)
+	}
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	if !isThrottlingError(minio.ErrorResponse{Code: "SlowDown", StatusCode: 503}) {
+		t.Errorf("SlowDown should be detected as throttling")
+	}
+	if !isThrottlingError(minio.ErrorResponse{StatusCode: 503}) {
+		t.Errorf("503 should be detected as throttling")
+	}
+	if isThrottlingError(minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}) {
+		t.Errorf("AccessDenied should not be detected as throttling")
+	}
+	if isThrottlingError(errors.New("connection refused")) {
+		t.Errorf("Generic errors should not be detected as throttling")
+	}
+}
+
+func TestRetryBackoffDoublesUpToMaxDelay(t *testing.T) {
+	backoff := newRetryBackoff(1*time.Second, 5*time.Second)
+	expected := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for _, delay := range expected {
+		if next := backoff.next(); next != delay {
+			t.Errorf("Expected %s got %s", delay, next)
+		}
+	}
+}
+
+func TestSeedingGivesUpAfterMaxRetries(t *testing.T) {
+	probe := getMemoryTestProbe("seed-retries")
+	probe.endpoint.s3Client = &failingPutS3Client{NewMemoryS3Client()}
+	probe.seedWorkers = 1
+
+	if err := probe.prepareDurabilityBucket(context.Background()); err == nil {
+		t.Errorf("Seeding should fail on an endpoint rejecting every write")
+	}
+	metric := &io_prometheus_client.Metric{}
+	probeSeedRetries.WithLabelValues("seed-retries").Write(metric)
+	if *metric.Counter.Value != float64(probe.seedMaxRetries) {
+		t.Errorf("Expected %d retries got %f", probe.seedMaxRetries, *metric.Counter.Value)
+	}
+}
+
+func TestSeedProgress(t *testing.T) {
+	percent, rate, eta := seedProgress(250, 1000, 5*time.Second)
+	if percent != 25 {
+		t.Errorf("Expected 25%% got %d%%", percent)
+	}
+	if rate != 50 {
+		t.Errorf("Expected 50 objects/s got %f", rate)
+	}
+	if eta != 15*time.Second {
+		t.Errorf("Expected an ETA of 15s got %s", eta)
+	}
+
+	if percent, _, _ := seedProgress(1, 3, time.Second); percent != 33 {
+		t.Errorf("Expected 33%% got %d%%", percent)
+	}
+}
+
+// consumingPutS3Client mimics clients reading the body of the uploads through Read,
+// consuming readers reused across uploads
+type consumingPutS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *consumingPutS3Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	return c.MemoryS3Client.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), objectSize, opts)
+}
+
+func TestSeedingWritesFullItemsWithConsumingClient(t *testing.T) {
+	probe := getMemoryTestProbe("seed-consuming")
+	probe.endpoint.s3Client = &consumingPutS3Client{NewMemoryS3Client()}
+	probe.seedWorkers = 1
+	if err := probe.prepareDurabilityBucket(context.Background()); err != nil {
+		t.Errorf("Durability bucket preparation failed: %s", err)
+	}
+	for i := 0; i < probe.durabilityItemTotal; i++ {
+		info, err := probe.endpoint.s3Client.StatObject(context.Background(), probe.durabilityBucketName, durabilityObjectName(i), minio.StatObjectOptions{})
+		if err != nil || info.Size != int64(probe.durabilityItemSize) {
+			t.Errorf("Durability item %d was not fully written (%d bytes): %v", i, info.Size, err)
+		}
+	}
+}
+
+func TestSharedPayloadIsGeneratedOncePerSize(t *testing.T) {
+	payload, _ := sharedPayload(64)
+	other, _ := sharedPayload(64)
+	if &payload[0] != &other[0] {
+		t.Errorf("Payloads of the same size should be shared")
+	}
+	if larger, _ := sharedPayload(128); len(larger) != 128 {
+		t.Errorf("Expected a 128 bytes payload got %d", len(larger))
+	}
+}
+
+func TestSeedingStopsWhenContextIsDone(t *testing.T) {
+	probe := getMemoryTestProbe("seed-cancelled")
+	probe.endpoint.s3Client = &failingPutS3Client{NewMemoryS3Client()}
+	probe.seedRetryMinDelay = time.Hour
+	probe.seedRetryMaxDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- probe.prepareDurabilityBucket(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected the seeding to stop with the context error got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Seeding should stop once the context is done")
+	}
+}
@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+// newHTTPClient creates the plain HTTP client used for the requests the S3 SDK doesn't
+// send itself: CORS preflight requests and fetches of presigned URLs
+func newHTTPClient(endpoint string, cfg *config.Config) (*http.Client, error) {
+	address, secure := parseEndpoint(endpoint, *cfg.Secure)
+	transport, err := newTransport(address, secure, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// preflightURL returns the path-style URL of the object on the endpoint
+func preflightURL(endpoint string, defaultSecure bool, bucketName string, objectName string) string {
+	address, secure := parseEndpoint(endpoint, defaultSecure)
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: address, Path: "/" + bucketName + "/" + objectName}
+	return u.String()
+}
+
+// performPreflightChecks sends the CORS preflight request a browser would send before
+// a GET of an object and checks that the endpoint allows it for the configured origin
+func (p *Probe) performPreflightChecks() error {
+	objectName := p.randomObjectName()
+	objectURL := preflightURL(p.endpoint.Name, p.defaultSecure, p.latencyBucketName, objectName)
+
+	operation := func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodOptions, objectURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Origin", p.preflightOrigin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		resp, err := p.preflightClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := checkPreflightResponse(resp, p.preflightOrigin); err != nil {
+			p.log(InfoLevel, "Invalid CORS preflight response", Fields{"error": err})
+			s3PreflightInvalidCORS.WithLabelValues(p.name).Inc()
+			return err
+		}
+		return nil
+	}
+	return p.mesureOperation("preflight_options", p.latencyBucketName, operation)
+}
+
+func checkPreflightResponse(resp *http.Response, origin string) error {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("Preflight request failed with status %d", resp.StatusCode)
+	}
+	allowedOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	if allowedOrigin != origin && allowedOrigin != "*" {
+		return fmt.Errorf("Origin %s is not allowed (Access-Control-Allow-Origin: %q)", origin, allowedOrigin)
+	}
+	for _, method := range strings.Split(resp.Header.Get("Access-Control-Allow-Methods"), ",") {
+		if strings.TrimSpace(method) == http.MethodGet {
+			return nil
+		}
+	}
+	return fmt.Errorf("GET is not allowed (Access-Control-Allow-Methods: %q)", resp.Header.Get("Access-Control-Allow-Methods"))
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/criteo/s3-probe/config"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func newPreflightTestServer(allowedOrigin string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Origin") == allowedOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", "PUT, GET")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestPerformPreflightCheckSuccess(t *testing.T) {
+	server := newPreflightTestServer("https://example.com")
+	defer server.Close()
+	testConfig := config.GetTestConfig()
+	probe := getMemoryTestProbe("preflight-success")
+	probe.endpoint.Name = server.URL
+	probe.preflightClient, _ = newHTTPClient(server.URL, &testConfig)
+
+	if err := probe.performPreflightChecks(); err != nil {
+		t.Errorf("Preflight check is failing: %s", err)
+	}
+}
+
+func TestPerformPreflightCheckInvalidCORS(t *testing.T) {
+	server := newPreflightTestServer("https://other.example.com")
+	defer server.Close()
+	testConfig := config.GetTestConfig()
+	probe := getMemoryTestProbe("preflight-invalid")
+	probe.endpoint.Name = server.URL
+	probe.preflightClient, _ = newHTTPClient(server.URL, &testConfig)
+
+	if err := probe.performPreflightChecks(); err == nil {
+		t.Errorf("Preflight check should fail when the origin is not allowed")
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3PreflightInvalidCORS.WithLabelValues("preflight-invalid").Write(metric)
+	if *metric.Counter.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Counter.Value)
+	}
+}
+
+func TestPreflightURL(t *testing.T) {
+	if u := preflightURL("https://s3.example.com", false, "bucket", "object"); u != "https://s3.example.com/bucket/object" {
+		t.Errorf("Unexpected preflight URL %s", u)
+	}
+	if u := preflightURL("localhost:9000", false, "bucket", "object"); u != "http://localhost:9000/bucket/object" {
+		t.Errorf("Unexpected preflight URL %s", u)
+	}
+	if u := preflightURL("localhost:9000", true, "bucket", "object"); u != "https://localhost:9000/bucket/object" {
+		t.Errorf("Unexpected preflight URL %s", u)
+	}
+	if u := preflightURL("http://localhost:9000", true, "bucket", "object"); u != "http://localhost:9000/bucket/object" {
+		t.Errorf("Unexpected preflight URL %s", u)
+	}
+}
@@ -0,0 +1,88 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+const presignExpiry = 5 * time.Minute
+
+// signatureRejectedError is returned when the endpoint refuses a presigned URL,
+// usually because of a clock skew or of misconfigured credentials
+type signatureRejectedError struct {
+	status string
+}
+
+func (e *signatureRejectedError) Error() string {
+	return fmt.Sprintf("Presigned URL rejected: %s", e.status)
+}
+
+// performPresignChecks writes an object, presigns a GET of the object and fetches it with
+// a plain HTTP client like a browser would, then checks the content and removes the object
+func (p *Probe) performPresignChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	payload, _ := randomPayload(objectSize)
+	payloadHash := sha256.Sum256(payload)
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("presign_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("presign_remove_object", p.latencyBucketName, operation)
+	}()
+
+	var presignedURL *url.URL
+	operation = func(ctx context.Context) error {
+		var err error
+		presignedURL, err = p.endpoint.s3Client.PresignedGetObject(ctx, p.latencyBucketName, objectName, presignExpiry, url.Values{})
+		return err
+	}
+	if err := p.mesureOperation("presign", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, presignedURL.String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := p.presignClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			p.log(WarnLevel, "Presigned URL was rejected, check the clock of the probe", Fields{"object": objectName})
+			return &signatureRejectedError{status: resp.Status}
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Presigned GET failed with status %s", resp.Status)
+		}
+		hash := sha256.New()
+		if _, err = io.Copy(hash, resp.Body); err != nil {
+			return err
+		}
+		if !bytes.Equal(hash.Sum(nil), payloadHash[:]) {
+			return errors.New("Presigned GET content doesn't match the written content")
+		}
+		return nil
+	}
+	return p.mesureOperation("presigned_get", p.latencyBucketName, operation)
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// presigningS3Client presigns URLs of a test server serving the objects of the in-memory backend
+type presigningS3Client struct {
+	*MemoryS3Client
+	serverURL string
+}
+
+func (c *presigningS3Client) PresignedGetObject(ctx context.Context, bucketName, objectName string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	return url.Parse(c.serverURL + "/" + bucketName + "/" + objectName + "?X-Amz-Signature=test")
+}
+
+func newPresignTestProbe(name string, handler func(client *MemoryS3Client) http.HandlerFunc) (Probe, *httptest.Server) {
+	client := NewMemoryS3Client()
+	server := httptest.NewServer(handler(client))
+	probe := getMemoryTestProbe(name)
+	probe.endpoint.s3Client = &presigningS3Client{MemoryS3Client: client, serverURL: server.URL}
+	probe.presignClient = &http.Client{}
+	return probe, server
+}
+
+func TestPresignCheckFetchesObject(t *testing.T) {
+	probe, server := newPresignTestProbe("presign", func(client *MemoryS3Client) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+			obj, err := client.GetObject(r.Context(), path[0], path[1], minio.GetObjectOptions{})
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			io.Copy(w, obj)
+		}
+	})
+	defer server.Close()
+
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performPresignChecks(); err != nil {
+		t.Errorf("Presign check failed: %s", err)
+	}
+}
+
+func TestPresignCheckReportsRejectedSignature(t *testing.T) {
+	probe, server := newPresignTestProbe("presign-rejected", func(client *MemoryS3Client) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	defer server.Close()
+
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err := probe.performPresignChecks()
+	if reason := classifyError(err); reason != "signature_rejected" {
+		t.Errorf("Expected signature_rejected got %s (%v)", reason, err)
+	}
+}
@@ -4,42 +4,92 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
+	mathrand "math/rand"
+	"net/http"
+	"os"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/criteo/s3-probe/config"
 	minio "github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/minio/minio-go/v7/pkg/lifecycle"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var s3LatencySummary = promauto.NewSummaryVec(prometheus.SummaryOpts{
+var latencySummaryOpts = prometheus.SummaryOpts{
 	Name: "s3_latency_seconds",
-	Help: "Latency for operation on the S3 endpoint",
-}, []string{"operation", "endpoint"})
+	Help: "Latency for operation on the S3 endpoint (size is the object size in bytes, empty when not relevant)",
+}
 
-var s3LatencyHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
-	Name:    "s3_latency_histogram_seconds",
-	Help:    "Latency for operation on the S3 endpoint",
-	Buckets: []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10},
-}, []string{"operation", "endpoint"})
+var s3LatencySummary = promauto.NewSummaryVec(latencySummaryOpts, []string{"operation", "endpoint", "bucket", "size"})
+
+var defaultLatencyHistogramBuckets = []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10}
+
+// latencyHistogramBuckets are the buckets of the latency histograms, set by ConfigureLatencyHistogram
+var latencyHistogramBuckets = defaultLatencyHistogramBuckets
+
+// s3LatencyHistogram can be aggregated across probes unlike s3LatencySummary, its buckets are set by ConfigureLatencyHistogram
+var s3LatencyHistogram = promauto.NewHistogramVec(newLatencyHistogramOpts(defaultLatencyHistogramBuckets), []string{"operation", "endpoint", "bucket", "size"})
+
+func newLatencyHistogramOpts(buckets []float64) prometheus.HistogramOpts {
+	return prometheus.HistogramOpts{
+		Name:    "s3_latency_histogram_seconds",
+		Help:    "Latency for operation on the S3 endpoint (size is the object size in bytes, empty when not relevant)",
+		Buckets: buckets,
+	}
+}
+
+// ConfigureLatencyHistogram replaces the buckets of the latency histogram with the comma separated
+// list of upper bounds (in seconds). It must be called before creating the probes
+func ConfigureLatencyHistogram(buckets string) error {
+	if strings.TrimSpace(buckets) == "" {
+		return nil
+	}
+	upperBounds := []float64{}
+	for _, bucket := range strings.Split(buckets, ",") {
+		upperBound, err := strconv.ParseFloat(strings.TrimSpace(bucket), 64)
+		if err != nil || upperBound <= 0 {
+			return fmt.Errorf("Invalid latency histogram bucket: %q", bucket)
+		}
+		if len(upperBounds) > 0 && upperBound <= upperBounds[len(upperBounds)-1] {
+			return fmt.Errorf("Latency histogram buckets must be sorted in increasing order: %s", buckets)
+		}
+		upperBounds = append(upperBounds, upperBound)
+	}
+	histogram := prometheus.NewHistogramVec(newLatencyHistogramOpts(upperBounds), []string{"operation", "endpoint", "bucket", "size"})
+	prometheus.Unregister(s3LatencyHistogram)
+	if err := prometheus.Register(histogram); err != nil {
+		return err
+	}
+	s3LatencyHistogram = histogram
+	latencyHistogramBuckets = upperBounds
+	return nil
+}
 
-var s3TotalCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var totalCounterOpts = prometheus.CounterOpts{
 	Name: "s3_request_total",
 	Help: "Total number of requests on S3 endpoint",
-}, []string{"operation", "endpoint"})
+}
 
-var s3SuccessCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3TotalCounter = promauto.NewCounterVec(totalCounterOpts, []string{"operation", "endpoint", "bucket"})
+
+var successCounterOpts = prometheus.CounterOpts{
 	Name: "s3_request_success_total",
 	Help: "Total number of successful requests on S3 endpoint",
-}, []string{"operation", "endpoint"})
+}
+
+var s3SuccessCounter = promauto.NewCounterVec(successCounterOpts, []string{"operation", "endpoint", "bucket"})
 
 var s3GatewayTotalCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_gateway_request_total",
@@ -51,6 +101,20 @@ var s3GatewaySuccessCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Total number of successful gateway requests on S3 endpoint",
 }, []string{"operation", "endpoint", "gateway_endpoint"})
 
+var probeInfoOpts = prometheus.GaugeOpts{
+	Name: "s3_probe_info",
+	Help: "Information about the probe of the endpoint and its configuration (always 1)",
+}
+
+var probeInfoLabels = []string{"endpoint", "address", "backend", "tls", "region", "bucket_lookup", "dial_timeout", "tls_handshake_timeout", "max_idle_conns_per_host", "keep_alives", "probe_rate", "durability_item_total", "latency_item_sizes"}
+
+var s3ProbeInfo = promauto.NewGaugeVec(probeInfoOpts, probeInfoLabels)
+
+var s3ProbeHeartbeat = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_probe_heartbeat_total",
+	Help: "Total number of probing loop ticks, independently of the S3 operations outcome",
+}, []string{"endpoint"})
+
 var s3ExpectedDurabilityItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Name: "s3_durability_items_expected",
 	Help: "Number of items that should be present on the endpoint",
@@ -61,232 +125,1024 @@ var s3FoundDurabilityItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Help: "Number of items that are present on the endpoint",
 }, []string{"endpoint"})
 
+var s3MissingDurabilityItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_items_missing",
+	Help: "Number of durability items missing (NoSuchKey) in the last sample",
+}, []string{"endpoint"})
+
+var durabilityReadyOpts = prometheus.GaugeOpts{
+	Name: "s3_durability_ready",
+	Help: "Whether the durability bucket is seeded enough to report durability (0 while seeding)",
+}
+
+var s3DurabilityReady = promauto.NewGaugeVec(durabilityReadyOpts, []string{"endpoint"})
+
+var s3ObjectNameRoundTripErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_object_name_roundtrip_errors_total",
+	Help: "Total number of objects that couldn't be retrieved under the name they were written with",
+}, []string{"endpoint", "charset"})
+
+var probeActiveChecks = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "probe_active_checks",
+	Help: "Number of checks currently running",
+}, []string{"endpoint"})
+
+var probeOpenConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "probe_open_connections",
+	Help: "Number of connections currently open by the probe to the S3 endpoint address",
+}, []string{"address"})
+
+var probeBuffersInUse = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "probe_buffers_in_use",
+	Help: "Number of read buffers currently taken from the buffer pool",
+})
+
 var probeBucketAttempt = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "probe_bucket_created_total",
 	Help: "Total number of monitoring bucket created",
 }, []string{"endpoint"})
 
+var probeBucketReconciled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "probe_bucket_reconciled_total",
+	Help: "Total number of buckets reported missing but already owned when created",
+}, []string{"endpoint", "bucket"})
+
+var s3ProbeCycleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_probe_cycle_duration_seconds",
+	Help:    "Duration of the probe cycles, from the start of their checks until the last one is done",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+}, []string{"endpoint"})
+
+var s3ProbeCycles = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_probe_cycles_total",
+	Help: "Total number of completed probe cycles",
+}, []string{"endpoint"})
+
+var s3RemoveObjectsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_remove_objects_errors_total",
+	Help: "Total number of objects reported as not removed by multi-object deletes",
+}, []string{"endpoint"})
+
+var s3TaggingMismatch = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_tagging_mismatch_total",
+	Help: "Total number of object tags read back different from the written ones",
+}, []string{"endpoint"})
+
+var s3BucketPrepareErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_bucket_prepare_errors_total",
+	Help: "Total number of buckets that could neither be created nor used while preparing the probe",
+}, []string{"endpoint", "bucket"})
+
+var s3RetryAfterWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_retry_after_wait_seconds",
+	Help:    "Waits honored before sending requests to endpoints that answered with a Retry-After header",
+	Buckets: []float64{.1, .5, 1, 5, 10, 30, 60, 300},
+}, []string{"address"})
+
+var s3ServedRegion = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_served_region",
+	Help: "Region reported by the endpoint in its response headers (always 1, the region is a label)",
+}, []string{"address", "region"})
+
+var s3RegionMismatch = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_region_mismatch",
+	Help: "1 when the region reported by the endpoint differs from the configured region",
+}, []string{"address"})
+
 var probeGatewayBucketAttempt = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "probe_gateway_bucket_created_total",
 	Help: "Total number of monitoring gateway bucket created",
 }, []string{"endpoint", "gateway_endpoint"})
 
+var s3VersioningAnomalies = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_versioning_anomalies_total",
+	Help: "Total number of unexpected behaviors observed on versioned deletes",
+}, []string{"endpoint", "anomaly"})
+
+var s3ContentMD5NotEnforced = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_content_md5_not_enforced_total",
+	Help: "Total number of uploads with a wrong Content-MD5 accepted by the S3 endpoint",
+}, []string{"endpoint"})
+
+var s3EdgeLatencyHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_edge_latency_seconds",
+	Help:    "Latency of GET operations through the edge endpoint",
+	Buckets: []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10},
+}, []string{"endpoint", "edge_endpoint", "cache_state"})
+
+var s3EdgeTotalCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_edge_request_total",
+	Help: "Total number of GET requests through the edge endpoint",
+}, []string{"endpoint", "edge_endpoint", "cache_state"})
+
+var s3EdgeSuccessCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_edge_request_success_total",
+	Help: "Total number of successful GET requests through the edge endpoint",
+}, []string{"endpoint", "edge_endpoint", "cache_state"})
+
+var s3EdgeNotFoundCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_edge_not_found_total",
+	Help: "Total number of GET requests through the edge endpoint on an object not yet visible from the edge",
+}, []string{"endpoint", "edge_endpoint"})
+
+var s3EdgeContentMismatchCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_edge_content_mismatch_total",
+	Help: "Total number of objects served by the edge endpoint with a content different from the origin",
+}, []string{"endpoint", "edge_endpoint"})
+
+var s3StatSizeLatencyRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_stat_size_latency_ratio",
+	Help: "Ratio between the median StatObject latencies on a large object and on a small object",
+}, []string{"endpoint"})
+
+var s3StatSizeDependentCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_stat_size_dependent_total",
+	Help: "Total number of StatObject checks where the latency on a large object exceeded the configured ratio",
+}, []string{"endpoint"})
+
+var s3MultipartAbortedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_multipart_aborted_total",
+	Help: "Total number of multipart uploads aborted after a failure",
+}, []string{"endpoint"})
+
+var s3OverwriteStaleReads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_overwrite_stale_reads_total",
+	Help: "Total number of reads after repeated overwrites not returning the last written content",
+}, []string{"endpoint"})
+
+var s3PreflightInvalidCORS = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_preflight_invalid_cors_total",
+	Help: "Total number of CORS preflight responses not allowing the configured origin to GET objects",
+}, []string{"endpoint"})
+
+var s3BucketObjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_bucket_objects",
+	Help: "Number of objects in the bucket as reported by the usage fetcher",
+}, []string{"endpoint", "bucket"})
+
+var s3BucketBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_bucket_bytes",
+	Help: "Total size of the objects in the bucket as reported by the usage fetcher",
+}, []string{"endpoint", "bucket"})
+
+var s3NotificationDeliveryHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_notification_delivery_seconds",
+	Help:    "Delay between an object creation and the delivery of its event notification",
+	Buckets: []float64{.010, .025, .050, .100, .250, .500, 1, 2.5, 5, 10, 30},
+}, []string{"endpoint"})
+
+var s3NotificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_notification_failures_total",
+	Help: "Total number of event notifications not delivered in time",
+}, []string{"endpoint"})
+
+var probeSeedRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "probe_seed_rate_objects_per_second",
+	Help: "Effective write rate of the durability bucket seeding",
+}, []string{"endpoint"})
+
+var probeSeedBackfilledItems = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "probe_seed_backfilled_items_total",
+	Help: "Total number of durability items missing from an existing durability bucket and written again",
+}, []string{"endpoint"})
+
+var probeSeedRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "probe_seed_retries_total",
+	Help: "Total number of retried writes during the durability bucket seeding",
+}, []string{"endpoint"})
+
+var s3ListObjectsKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_list_objects_keys",
+	Help: "Number of keys returned by the last list_objects of the latency probe",
+}, []string{"endpoint", "bucket"})
+
+var s3BytesUploaded = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_bytes_uploaded_total",
+	Help: "Total number of bytes of the objects written on the S3 endpoint",
+}, []string{"operation", "endpoint"})
+
+var s3BytesDownloaded = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_bytes_downloaded_total",
+	Help: "Total number of bytes read from the S3 endpoint",
+}, []string{"operation", "endpoint"})
+
+var s3IntegrityErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_integrity_errors_total",
+	Help: "Total number of objects read back by the latency probe with a content different from the written one",
+}, []string{"endpoint"})
+
+var s3ReadAfterWrite = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_read_after_write_seconds",
+	Help:    "Time between the end of a write and the first successful read of the object",
+	Buckets: []float64{.001, .005, .010, .025, .050, .100, .250, .500, 1, 2.5, 5, 10},
+}, []string{"endpoint"})
+
+var s3ReadAfterWriteInconsistent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_read_after_write_inconsistent_total",
+	Help: "Total number of written objects which were still not readable at the end of the consistency window",
+}, []string{"endpoint"})
+
+var requestErrorsOpts = prometheus.CounterOpts{
+	Name: "s3_request_errors_total",
+	Help: "Total number of failed operations on the S3 endpoint by reason (S3 error code, timeout, dns, connection or other)",
+}
+
+var s3RequestErrors = promauto.NewCounterVec(requestErrorsOpts, []string{"operation", "endpoint", "bucket", "reason"})
+
+var operationTimeoutsOpts = prometheus.CounterOpts{
+	Name: "s3_operation_timeouts_total",
+	Help: "Total number of operations on the S3 endpoint which failed because they exceeded the latency timeout",
+}
+
+var s3OperationTimeouts = promauto.NewCounterVec(operationTimeoutsOpts, []string{"operation", "endpoint", "bucket"})
+
+var s3GetObjectBytesRead = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_get_object_bytes_read",
+	Help: "Number of bytes read by the last get_object of the latency probe, should match the size label",
+}, []string{"endpoint", "bucket", "size"})
+
+var s3ObjectLockAnomalies = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_object_lock_anomalies_total",
+	Help: "Total number of unexpected behaviors observed on governance-locked objects",
+}, []string{"endpoint", "anomaly"})
+
 const millisecondInMinute = 60_000
 
 // Probe is a S3 probe
 type Probe struct {
 	name                      string
+	metrics                   probeMetrics
+	logger                    Logger
+	region                    string
 	gateway                   bool
 	endpoint                  S3Endpoint
 	secretKey                 string
 	accessKey                 string
 	latencyBucketName         string
+	extraLatencyBucketNames   []string
 	durabilityBucketName      string
 	gatewayBucketName         string
 	probeRatePerMin           int
 	durabilityProbeRatePerMin int
 	latencyItemSize           int
+	latencyItemSizes          []int64
 	durabilityItemSize        int
 	durabilityItemTotal       int
+	durabilitySampleSize      int
+	durabilityReadyThreshold  float64
+	durabilityReady           int32
+	running                   int32
 	durabilityTimeout         time.Duration
 	latencyTimeout            time.Duration
+	latencyMetric             string
+	listObjectsMaxKeys        int
+	rangeGetSize              int64
+	lifecycleExpirationDays   int
 	gatewayEndpoints          []S3Endpoint
-	controlChan               chan bool
+	objectNameLength          int
+	objectNameCharset         string
+	edgeEndpoint              *S3Endpoint
+	edgeLagTimeout            time.Duration
+	versioningProbe           bool
+	versioningBucketName      string
+	objectLockProbe           bool
+	objectLockBucketName      string
+	largeStatProbe            bool
+	largeStatObject           string
+	largeStatSize             int64
+	largeStatSamples          int
+	largeStatRatio            float64
+	multipartProbeRatePerMin  int
+	multipartPartSize         int
+	multipartParts            int
+	overwriteProbeRatePerMin  int
+	readAfterWriteRatePerMin  int
+	readAfterWriteWindow      time.Duration
+	probeJitter               float64
+	overwriteCount            int
+	defaultSecure             bool
+	preflightClient           *http.Client
+	presignClient             *http.Client
+	preflightOrigin           string
+	usageFetcher              UsageFetcher
+	notificationSink          NotificationSink
+	notificationTimeout       time.Duration
+	sendContentMD5            bool
+	contentMD5Probe           bool
+	copyProbe                 bool
+	taggingProbe              bool
+	removeObjectsProbe        bool
+	bucketProbe               bool
+	removeObjectsCount        int
+	seedMinDelay              time.Duration
+	seedMaxDelay              time.Duration
+	seedRetryMinDelay         time.Duration
+	seedRetryMaxDelay         time.Duration
+	seedMaxRetries            int
+	seedWorkers               int
+	// ctx is the context of the running probe, checks operations are cancelled when it is done
+	ctx    context.Context
+	checks *sync.WaitGroup
 }
 
 // S3Endpoint holds the endpoint name address and the client to connect to it
 type S3Endpoint struct {
 	Name     string
-	s3Client *minio.Client
+	s3Client S3Client
+}
+
+// validateRate checks that a rate per minute can be turned into a ticker, 0 disables the probe
+// when allowDisabled is true
+func validateRate(name string, rate int, allowDisabled bool) error {
+	if rate == 0 && allowDisabled {
+		return nil
+	}
+	if rate <= 0 || rate > millisecondInMinute {
+		return fmt.Errorf("%s must be in [1, %d] per minute, got %d", name, millisecondInMinute, rate)
+	}
+	return nil
 }
 
 // NewProbe creates a new S3 probe
-func NewProbe(service S3Service, endpoint string, gatewayEndpoints []S3Endpoint, cfg *config.Config, controlChan chan bool) (Probe, error) {
-	minioClient, err := newMinioClientFromEndpoint(endpoint, *cfg.AccessKey, *cfg.SecretKey)
+func NewProbe(service S3Service, endpoint string, gatewayEndpoints []S3Endpoint, cfg *config.Config) (Probe, error) {
+	return newProbe(service, endpoint, gatewayEndpoints, cfg, defaultProbeMetrics())
+}
+
+func newProbe(service S3Service, endpoint string, gatewayEndpoints []S3Endpoint, cfg *config.Config, metrics probeMetrics) (Probe, error) {
+	if err := validateRate("Probe rate", *cfg.ProbeRatePerMin, false); err != nil {
+		return Probe{}, err
+	}
+	if err := validateRate("Durability probe rate", *cfg.DurabilityProbeRatePerMin, true); err != nil {
+		return Probe{}, err
+	}
+	if err := validateRate("Multipart probe rate", *cfg.MultipartProbeRatePerMin, true); err != nil {
+		return Probe{}, err
+	}
+	if err := validateRate("Overwrite probe rate", *cfg.OverwriteProbeRatePerMin, true); err != nil {
+		return Probe{}, err
+	}
+	if err := validateRate("Read-after-write probe rate", *cfg.ReadAfterWriteRatePerMin, true); err != nil {
+		return Probe{}, err
+	}
+	if *cfg.ProbeJitter < 0 || *cfg.ProbeJitter >= 1 {
+		return Probe{}, fmt.Errorf("Probe jitter must be in [0, 1[, got %f", *cfg.ProbeJitter)
+	}
+	if *cfg.LifecycleExpirationDays < 0 {
+		return Probe{}, fmt.Errorf("Lifecycle expiration days must be positive, got %d", *cfg.LifecycleExpirationDays)
+	}
+	logger, err := NewLogger(os.Stderr, *cfg.LogFormat, *cfg.LogLevel)
+	if err != nil {
+		return Probe{}, err
+	}
+	if *cfg.RemoveObjectsCount < 1 {
+		return Probe{}, fmt.Errorf("Remove objects count must be at least 1, got %d", *cfg.RemoveObjectsCount)
+	}
+	if *cfg.LargeStatSize < 1 || *cfg.LargeStatSamples < 1 {
+		return Probe{}, fmt.Errorf("Large stat size and samples must be at least 1, got %d and %d", *cfg.LargeStatSize, *cfg.LargeStatSamples)
+	}
+	if *cfg.LargeStatRatio <= 0 {
+		return Probe{}, fmt.Errorf("Large stat ratio must be strictly positive, got %f", *cfg.LargeStatRatio)
+	}
+	if *cfg.MultipartPartSize < 1 || *cfg.MultipartParts < 1 {
+		return Probe{}, fmt.Errorf("Multipart part size and parts must be at least 1, got %d and %d", *cfg.MultipartPartSize, *cfg.MultipartParts)
+	}
+	if *cfg.RangeGetSize < 0 {
+		return Probe{}, fmt.Errorf("Range get size must be positive, got %d", *cfg.RangeGetSize)
+	}
+	if *cfg.DialTimeout < 0 || *cfg.TLSHandshakeTimeout < 0 {
+		return Probe{}, fmt.Errorf("Dial and TLS handshake timeouts must be positive, got %s and %s", *cfg.DialTimeout, *cfg.TLSHandshakeTimeout)
+	}
+	if *cfg.MaxIdleConnsPerHost < 0 {
+		return Probe{}, fmt.Errorf("Max idle connections per host must be positive, got %d", *cfg.MaxIdleConnsPerHost)
+	}
+	if *cfg.DurabilityItemTotal < 1 {
+		return Probe{}, fmt.Errorf("Durability item total must be at least 1, got %d", *cfg.DurabilityItemTotal)
+	}
+	if *cfg.DurabilityReadyThreshold <= 0 || *cfg.DurabilityReadyThreshold > 1 {
+		return Probe{}, fmt.Errorf("Durability ready threshold must be in ]0, 1], got %f", *cfg.DurabilityReadyThreshold)
+	}
+
+	latencyItemSizes, err := parseLatencyItemSizes(*cfg.LatencyItemSizes, *cfg.LatencyItemSize)
+	if err != nil {
+		return Probe{}, err
+	}
+	if *cfg.LatencyMetric != "summary" && *cfg.LatencyMetric != "histogram" && *cfg.LatencyMetric != "both" {
+		return Probe{}, fmt.Errorf("Latency metric must be summary, histogram or both, got %s", *cfg.LatencyMetric)
+	}
+	if *cfg.SeedWorkers < 1 {
+		return Probe{}, fmt.Errorf("Seed workers must be at least 1, got %d", *cfg.SeedWorkers)
+	}
+	if *cfg.OverwriteCount < 1 {
+		return Probe{}, fmt.Errorf("Overwrite count must be at least 1, got %d", *cfg.OverwriteCount)
+	}
+	if !isValidObjectNameCharset(*cfg.ObjectNameCharset) {
+		return Probe{}, fmt.Errorf("Unknown object name charset: %s", *cfg.ObjectNameCharset)
+	}
+	// S3 keys are limited to 1024 bytes, multi-byte characters of the charset may be picked for every character
+	if *cfg.ObjectNameLength <= 0 || objectNameMaxBytes(*cfg.ObjectNameLength, *cfg.ObjectNameCharset) > maxObjectNameBytes {
+		return Probe{}, fmt.Errorf("Object name length must be in [1, %d] with the %s charset, got %d", maxObjectNameBytes/objectNameMaxBytes(1, *cfg.ObjectNameCharset), *cfg.ObjectNameCharset, *cfg.ObjectNameLength)
+	}
+
+	s3Client, err := newS3Client(endpoint, cfg)
 	if err != nil {
 		return Probe{}, err
 	}
+	metrics.durabilityReady.WithLabelValues(service.Name).Set(0)
+	address, secure := parseEndpoint(endpoint, *cfg.Secure)
+	metrics.probeInfo.WithLabelValues(
+		service.Name,
+		address,
+		*cfg.Backend,
+		strconv.FormatBool(secure && *cfg.Backend == "s3"),
+		*cfg.Region,
+		*cfg.BucketLookup,
+		cfg.DialTimeout.String(),
+		cfg.TLSHandshakeTimeout.String(),
+		strconv.Itoa(*cfg.MaxIdleConnsPerHost),
+		strconv.FormatBool(!*cfg.DisableKeepAlives),
+		strconv.Itoa(*cfg.ProbeRatePerMin),
+		strconv.Itoa(*cfg.DurabilityItemTotal),
+		formatLatencyItemSizes(latencyItemSizes),
+	).Set(1)
 
-	log.Println("Probe created for:", endpoint)
+	var edgeEndpoint *S3Endpoint
+	if service.EdgeEndpoint != "" {
+		edgeClient, err := newS3Client(service.EdgeEndpoint, cfg)
+		if err != nil {
+			return Probe{}, err
+		}
+		edgeEndpoint = &S3Endpoint{Name: service.EdgeEndpoint, s3Client: edgeClient}
+		logger.Log(InfoLevel, "Edge endpoint configured", Fields{"endpoint": service.Name, "edge": service.EdgeEndpoint})
+	}
+
+	var preflightClient *http.Client
+	if *cfg.PreflightProbe {
+		preflightClient, err = newHTTPClient(endpoint, cfg)
+		if err != nil {
+			return Probe{}, err
+		}
+	}
+
+	var presignClient *http.Client
+	if *cfg.PresignProbe {
+		presignClient, err = newHTTPClient(endpoint, cfg)
+		if err != nil {
+			return Probe{}, err
+		}
+	}
+
+	var usageFetcher UsageFetcher
+	if *cfg.UsageFetcher != "" {
+		var ok bool
+		usageFetcher, ok = getUsageFetcher(*cfg.UsageFetcher)
+		if !ok {
+			return Probe{}, fmt.Errorf("Unknown usage fetcher: %s", *cfg.UsageFetcher)
+		}
+	}
+
+	var notificationSink NotificationSink
+	if *cfg.NotificationSink != "" {
+		var ok bool
+		notificationSink, ok = getNotificationSink(*cfg.NotificationSink)
+		if !ok {
+			return Probe{}, fmt.Errorf("Unknown notification sink: %s", *cfg.NotificationSink)
+		}
+	}
+
+	bucketName := func(name string) string {
+		if *cfg.NormalizeBucketNames {
+			return normalizeBucketName(name)
+		}
+		return name
+	}
+
+	latencyBucketNames := []string{}
+	for _, name := range strings.Split(*cfg.LatencyBucketName, ",") {
+		latencyBucketNames = append(latencyBucketNames, bucketName(strings.TrimSpace(name)))
+	}
+
+	logger.Log(InfoLevel, "Probe created", Fields{"endpoint": service.Name, "address": endpoint, "bucket_lookup": *cfg.BucketLookup})
 	return Probe{
+		metrics:                   metrics,
+		logger:                    logger,
+		region:                    *cfg.Region,
 		name:                      service.Name,
 		gateway:                   service.Gateway,
-		endpoint:                  S3Endpoint{Name: endpoint, s3Client: minioClient},
+		endpoint:                  S3Endpoint{Name: endpoint, s3Client: s3Client},
 		secretKey:                 *cfg.SecretKey,
 		accessKey:                 *cfg.AccessKey,
-		latencyBucketName:         *cfg.LatencyBucketName,
-		durabilityBucketName:      *cfg.DurabilityBucketName,
-		gatewayBucketName:         *cfg.GatewayBucketName,
+		latencyBucketName:         latencyBucketNames[0],
+		extraLatencyBucketNames:   latencyBucketNames[1:],
+		durabilityBucketName:      bucketName(*cfg.DurabilityBucketName),
+		gatewayBucketName:         bucketName(*cfg.GatewayBucketName),
 		probeRatePerMin:           *cfg.ProbeRatePerMin,
 		durabilityProbeRatePerMin: *cfg.DurabilityProbeRatePerMin,
 		latencyItemSize:           *cfg.LatencyItemSize,
+		latencyItemSizes:          latencyItemSizes,
 		durabilityItemSize:        *cfg.DurabilityItemSize,
 		durabilityItemTotal:       *cfg.DurabilityItemTotal,
+		durabilitySampleSize:      *cfg.DurabilitySampleSize,
+		durabilityReadyThreshold:  *cfg.DurabilityReadyThreshold,
 		durabilityTimeout:         *cfg.DurabilityTimeout,
 		latencyTimeout:            *cfg.LatencyTimeout,
-		controlChan:               controlChan,
+		latencyMetric:             *cfg.LatencyMetric,
+		listObjectsMaxKeys:        *cfg.ListObjectsMaxKeys,
+		rangeGetSize:              int64(*cfg.RangeGetSize),
+		lifecycleExpirationDays:   *cfg.LifecycleExpirationDays,
+		versioningProbe:           *cfg.VersioningProbe,
+		versioningBucketName:      bucketName(*cfg.VersioningBucketName),
+		objectLockProbe:           *cfg.ObjectLockProbe,
+		objectLockBucketName:      bucketName(*cfg.ObjectLockBucketName),
+		largeStatProbe:            *cfg.LargeStatProbe,
+		largeStatObject:           *cfg.LargeStatObject,
+		largeStatSize:             int64(*cfg.LargeStatSize),
+		largeStatSamples:          *cfg.LargeStatSamples,
+		largeStatRatio:            *cfg.LargeStatRatio,
+		multipartProbeRatePerMin:  *cfg.MultipartProbeRatePerMin,
+		multipartPartSize:         *cfg.MultipartPartSize,
+		multipartParts:            *cfg.MultipartParts,
+		overwriteProbeRatePerMin:  *cfg.OverwriteProbeRatePerMin,
+		readAfterWriteRatePerMin:  *cfg.ReadAfterWriteRatePerMin,
+		readAfterWriteWindow:      *cfg.ReadAfterWriteWindow,
+		probeJitter:               *cfg.ProbeJitter,
+		overwriteCount:            *cfg.OverwriteCount,
+		defaultSecure:             *cfg.Secure,
+		preflightClient:           preflightClient,
+		presignClient:             presignClient,
+		preflightOrigin:           *cfg.PreflightOrigin,
+		usageFetcher:              usageFetcher,
+		notificationSink:          notificationSink,
+		notificationTimeout:       *cfg.NotificationTimeout,
+		sendContentMD5:            *cfg.SendContentMD5,
+		contentMD5Probe:           *cfg.ContentMD5Probe,
+		copyProbe:                 *cfg.CopyProbe,
+		taggingProbe:              *cfg.TaggingProbe,
+		removeObjectsProbe:        *cfg.RemoveObjectsProbe,
+		bucketProbe:               *cfg.BucketProbe,
+		removeObjectsCount:        *cfg.RemoveObjectsCount,
+		seedMinDelay:              *cfg.SeedMinDelay,
+		seedMaxDelay:              *cfg.SeedMaxDelay,
+		seedRetryMinDelay:         *cfg.SeedRetryMinDelay,
+		seedRetryMaxDelay:         *cfg.SeedRetryMaxDelay,
+		seedMaxRetries:            *cfg.SeedMaxRetries,
+		seedWorkers:               *cfg.SeedWorkers,
+		ctx:                       context.Background(),
+		checks:                    &sync.WaitGroup{},
 		gatewayEndpoints:          gatewayEndpoints,
+		objectNameLength:          *cfg.ObjectNameLength,
+		objectNameCharset:         *cfg.ObjectNameCharset,
+		edgeEndpoint:              edgeEndpoint,
+		edgeLagTimeout:            *cfg.EdgeLagTimeout,
 	}, nil
 }
 
-func newMinioClientFromEndpoint(endpoint string, accessKey string, secretKey string) (*minio.Client, error) {
-	re := regexp.MustCompile("^(http[s]+://)?(.*)")
+// parseEndpoint splits the optional scheme from the endpoint address, endpoints
+// without scheme use TLS when defaultSecure is set
+func parseEndpoint(endpoint string, defaultSecure bool) (string, bool) {
+	re := regexp.MustCompile("^(https?://)?(.*)")
 	match := re.FindStringSubmatch(endpoint)
-	secure := false
-	if match[1] == "https://" {
-		endpoint = match[2]
-		secure = true
-	} else if match[1] == "http://" {
-		endpoint = match[2]
+	if match[1] == "" {
+		return match[2], defaultSecure
+	}
+	return match[2], match[1] == "https://"
+}
+
+func newMinioClientFromEndpoint(endpoint string, cfg *config.Config) (*minio.Client, error) {
+	endpoint, secure := parseEndpoint(endpoint, *cfg.Secure)
+	transport, err := newTransport(endpoint, secure, cfg)
+	if err != nil {
+		return nil, err
+	}
+	bucketLookup, err := parseBucketLookup(*cfg.BucketLookup)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := newCredentials(cfg)
+	if err != nil {
+		return nil, err
 	}
 	return minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
+		Creds:        creds,
+		Secure:       secure,
+		Region:       *cfg.Region,
+		Transport:    newRegionTransport(newRetryAfterTransport(transport, endpoint), endpoint, *cfg.RegionHeader, *cfg.Region),
+		BucketLookup: bucketLookup,
 	})
 }
 
 type timer struct {
 	C      <-chan time.Time
 	Ticker *time.Ticker
+	stop   chan struct{}
 }
 
-func newTimer(rate int) timer {
+// newTimer ticks rate times per minute, each interval is randomized by up to +/- jitter
+// (a ratio of the interval) so probes started together don't hit the endpoint in lockstep
+func newTimer(rate int, jitter float64) timer {
 	if rate == 0 {
 		fakeTimer := make(chan time.Time)
 		return timer{C: fakeTimer, Ticker: nil}
 	}
-	ticker := time.NewTicker(time.Duration(millisecondInMinute/rate) * time.Millisecond)
-	return timer{Ticker: ticker, C: ticker.C}
+	interval := time.Duration(millisecondInMinute/rate) * time.Millisecond
+	if jitter <= 0 {
+		ticker := time.NewTicker(interval)
+		return timer{Ticker: ticker, C: ticker.C}
+	}
+
+	ticks := make(chan time.Time, 1)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-time.After(jitterInterval(interval, jitter)):
+				// Like time.Ticker, ticks are dropped when the receiver is late
+				select {
+				case ticks <- now:
+				default:
+				}
+			}
+		}
+	}()
+	return timer{C: ticks, stop: stop}
+}
+
+// jitterInterval returns an interval uniformly drawn in [interval*(1-jitter), interval*(1+jitter)],
+// the average interval is unchanged
+func jitterInterval(interval time.Duration, jitter float64) time.Duration {
+	return time.Duration(float64(interval) * (1 + jitter*(2*mathrand.Float64()-1)))
 }
 
 func (t *timer) Stop() {
 	if t.Ticker != nil {
 		t.Ticker.Stop()
 	}
+	if t.stop != nil {
+		close(t.stop)
+	}
 }
 
-func (p *Probe) PrepareProbing() error {
-	log.Println("Prepare probing")
+// PrepareProbing creates the buckets of the probe and seeds its durability bucket, the
+// seeding stops when the context is done
+func (p *Probe) PrepareProbing(ctx context.Context) error {
+	p.log(InfoLevel, "Prepare probing", nil)
 
 	if p.gateway {
 		err := p.prepareGatewayBucket()
 		if err != nil {
-			log.Println("Error: cannot prepare gateway latency bucket:", err)
+			p.log(ErrorLevel, "Cannot prepare gateway latency bucket", Fields{"error": err})
 			return err
 		}
 	} else {
 		err := p.prepareLatencyBucket()
 		if err != nil {
-			log.Println("Error: cannot prepare latency bucket:", err)
+			p.log(ErrorLevel, "Cannot prepare latency bucket", Fields{"error": err})
 			return err
 		}
-		err = p.prepareDurabilityBucket()
+		err = p.prepareDurabilityBucket(ctx)
 		if err != nil {
-			log.Println("Error: cannot prepare durability bucket:", err)
+			p.log(ErrorLevel, "Cannot prepare durability bucket", Fields{"error": err})
 			return err
 		}
+		if p.versioningProbe {
+			err = p.prepareVersioningBucket()
+			if err != nil {
+				p.log(ErrorLevel, "Cannot prepare versioning bucket", Fields{"error": err})
+				return err
+			}
+		}
+		if p.objectLockProbe {
+			err = p.prepareObjectLockBucket()
+			if err != nil {
+				p.log(ErrorLevel, "Cannot prepare object lock bucket", Fields{"error": err})
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-// StartProbing start to probe the S3 endpoint
-func (p *Probe) StartProbing() error {
-	log.Println("Starting probing")
+// cycleChecks returns the checks performed on every tick of the probe rate
+func (p *Probe) cycleChecks() []func() error {
+	if p.gateway {
+		return []func() error{p.performGatewayChecks}
+	}
+	checks := []func() error{p.performLatencyChecks}
+	if p.versioningProbe {
+		checks = append(checks, p.performVersioningChecks)
+	}
+	if p.objectLockProbe {
+		checks = append(checks, p.performObjectLockChecks)
+	}
+	if p.contentMD5Probe {
+		checks = append(checks, p.performContentMD5Checks)
+	}
+	if p.copyProbe {
+		checks = append(checks, p.performCopyChecks)
+	}
+	if p.taggingProbe {
+		checks = append(checks, p.performTaggingChecks)
+	}
+	if p.removeObjectsProbe {
+		checks = append(checks, p.performRemoveObjectsChecks)
+	}
+	if p.bucketProbe {
+		checks = append(checks, p.performBucketChecks)
+	}
+	if p.largeStatProbe {
+		checks = append(checks, p.performLargeStatChecks)
+	}
+	if p.edgeEndpoint != nil {
+		checks = append(checks, p.performEdgeChecks)
+	}
+	if p.notificationSink != nil {
+		checks = append(checks, p.performNotificationChecks)
+	}
+	if p.preflightClient != nil {
+		checks = append(checks, p.performPreflightChecks)
+	}
+	if p.presignClient != nil {
+		checks = append(checks, p.performPresignChecks)
+	}
+	return checks
+}
+
+// StartProbing start to probe the S3 endpoint until the context is done
+func (p *Probe) StartProbing(ctx context.Context) error {
+	p.log(InfoLevel, "Starting probing", nil)
+	p.ctx = ctx
+	atomic.StoreInt32(&p.running, 1)
+	defer atomic.StoreInt32(&p.running, 0)
 
-	tickerProbe := newTimer(p.probeRatePerMin)
-	tickerDurabilityProbe := newTimer(p.durabilityProbeRatePerMin)
+	tickerProbe := newTimer(p.probeRatePerMin, p.probeJitter)
+	tickerDurabilityProbe := newTimer(p.durabilityProbeRatePerMin, p.probeJitter)
+	tickerMultipartProbe := newTimer(p.multipartProbeRatePerMin, p.probeJitter)
+	tickerOverwriteProbe := newTimer(p.overwriteProbeRatePerMin, p.probeJitter)
+	tickerReadAfterWriteProbe := newTimer(p.readAfterWriteRatePerMin, p.probeJitter)
 
 	for {
 		select {
-		// If we receive something on the control chan we terminate
-		// otherwise we continue to perform checks
-		case <-p.controlChan:
-			log.Println("Terminating probe on", p.name)
+		// When the context is done we wait for the running checks (their operations
+		// are cancelled) and terminate, otherwise we continue to perform checks
+		case <-ctx.Done():
+			p.log(InfoLevel, "Terminating probe", nil)
 			tickerProbe.Stop()
 			tickerDurabilityProbe.Stop()
+			tickerMultipartProbe.Stop()
+			tickerOverwriteProbe.Stop()
+			tickerReadAfterWriteProbe.Stop()
+			p.checks.Wait()
 			return nil
 		case <-tickerProbe.C:
-			if p.gateway {
-				go p.performGatewayChecks()
-			} else {
-				go p.performLatencyChecks()
-			}
+			p.spawnCycle(p.cycleChecks())
 		case <-tickerDurabilityProbe.C:
 			if !p.gateway {
-				go p.performDurabilityChecks()
+				p.spawnCheck(p.performDurabilityChecks)
+				if p.usageFetcher != nil {
+					p.spawnCheck(p.performUsageChecks)
+				}
+			}
+		case <-tickerMultipartProbe.C:
+			if !p.gateway {
+				p.spawnCheck(p.performMultipartChecks)
+			}
+		case <-tickerOverwriteProbe.C:
+			if !p.gateway {
+				p.spawnCheck(p.performOverwriteChecks)
+			}
+		case <-tickerReadAfterWriteProbe.C:
+			if !p.gateway {
+				p.spawnCheck(p.performReadAfterWriteChecks)
 			}
 		}
+		// Every tick is a heartbeat, whatever the outcome of the checks
+		s3ProbeHeartbeat.WithLabelValues(p.name).Inc()
 	}
 }
 
 func (p *Probe) performDurabilityChecks() error {
-	ctx, cancel := context.WithTimeout(context.Background(), p.durabilityTimeout)
+	ctx, cancel := context.WithTimeout(p.ctx, p.durabilityTimeout)
 	defer cancel()
-	s3ExpectedDurabilityItems.WithLabelValues(p.name).Set(float64(p.durabilityItemTotal))
 	objectCh := p.endpoint.s3Client.ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{})
 	objectTotal := 0
 	for object := range objectCh {
 		if object.Err != nil {
-			log.Println(object.Err)
+			p.log(InfoLevel, "Error while listing durability bucket", Fields{"error": object.Err})
 			return object.Err
 		}
 		objectTotal++
 	}
+
+	// Until enough objects are seeded, missing objects are expected and must not be reported
+	if !p.isDurabilityReady() {
+		if float64(objectTotal) < p.durabilityReadyThreshold*float64(p.durabilityItemTotal) {
+			p.log(DebugLevel, "Durability bucket is still seeding", Fields{"objects": objectTotal, "total": p.durabilityItemTotal})
+			return nil
+		}
+		p.setDurabilityReady()
+	}
+
+	s3ExpectedDurabilityItems.WithLabelValues(p.name).Set(float64(p.durabilityItemTotal))
 	s3FoundDurabilityItems.WithLabelValues(p.name).Set(float64(objectTotal))
-	return nil
+	return p.sampleDurabilityItems()
 }
 
 func (p *Probe) performLatencyChecks() error {
-	objectName, _ := randomHex(20)
-	objectSize := int64(p.latencyItemSize)
-
 	operation := func(ctx context.Context) error {
 		_, err := p.endpoint.s3Client.ListBuckets(ctx)
 		return err
 	}
-	if err := p.mesureOperation("list_buckets", operation); err != nil {
+	if err := p.mesureOperation("list_buckets", "", operation); err != nil {
 		return err
 	}
 
-	objectData, _ := randomObject(objectSize)
-	operation = func(ctx context.Context) error {
-		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+	// A failed listing is already recorded, the object operations are still measured
+	var listErr error
+	if p.listObjectsMaxKeys > 0 {
+		listErr = p.mesureOperation("list_objects", p.durabilityBucketName, p.listDurabilityObjects)
+	}
+
+	for _, bucketName := range p.latencyBucketNames() {
+		for _, objectSize := range p.latencyItemSizes {
+			if err := p.performSizedLatencyChecks(bucketName, objectSize); err != nil {
+				return err
+			}
+		}
+	}
+	return listErr
+}
+
+// latencyBucketNames returns the buckets probed by the latency checks, the latency
+// bucket first then the extra latency buckets
+func (p *Probe) latencyBucketNames() []string {
+	return append([]string{p.latencyBucketName}, p.extraLatencyBucketNames...)
+}
+
+// listDurabilityObjects lists up to listObjectsMaxKeys keys of the durability bucket
+func (p *Probe) listDurabilityObjects(ctx context.Context) error {
+	// The listing goes on with the next pages as long as its context is not canceled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keys := 0
+	objectCh := p.endpoint.s3Client.ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{MaxKeys: p.listObjectsMaxKeys})
+	for object := range objectCh {
+		if keys >= p.listObjectsMaxKeys {
+			// Drain the channel so the listing goroutine exits
+			continue
+		}
+		if object.Err != nil {
+			return object.Err
+		}
+		keys++
+		if keys == p.listObjectsMaxKeys {
+			cancel()
+		}
+	}
+	s3ListObjectsKeys.WithLabelValues(p.name, p.durabilityBucketName).Set(float64(keys))
+	return nil
+}
+
+// performSizedLatencyChecks writes, reads and removes an object of the given size in the bucket
+func (p *Probe) performSizedLatencyChecks(bucketName string, objectSize int64) error {
+	objectName := p.randomObjectName()
+	payload, _ := randomPayload(objectSize)
+	payloadHash := sha256.Sum256(payload)
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, bucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{SendContentMd5: p.sendContentMD5})
+		if err == nil {
+			s3BytesUploaded.WithLabelValues("put_object", p.name).Add(float64(objectSize))
+		}
 		return err
 	}
-	if err := p.mesureOperation("put_object", operation); err != nil {
+	if err := p.mesureSizedOperation("put_object", bucketName, objectSize, operation); err != nil {
 		return err
 	}
 
 	operation = func(ctx context.Context) error {
-		obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+		obj, err := p.endpoint.s3Client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
 		defer obj.Close()
-		data := make([]byte, p.latencyItemSize)
-		for {
-			_, err = obj.Read(data)
-			if err == io.EOF {
-				return nil
-			} else if err != nil {
-				return err
+		// GetObject is lazy: the object is only downloaded while its body is read
+		data := getReadBuffer()
+		defer putReadBuffer(data)
+		hash := sha256.New()
+		read, err := io.CopyBuffer(hash, obj, *data)
+		s3BytesDownloaded.WithLabelValues("get_object", p.name).Add(float64(read))
+		s3GetObjectBytesRead.WithLabelValues(p.name, bucketName, strconv.FormatInt(objectSize, 10)).Set(float64(read))
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				p.log(WarnLevel, "Object written but not found", Fields{"object": objectName})
+				s3ObjectNameRoundTripErrors.WithLabelValues(p.name, p.objectNameCharset).Inc()
 			}
+			return err
+		}
+		if !bytes.Equal(hash.Sum(nil), payloadHash[:]) {
+			p.log(WarnLevel, "Object read back with a different content than written", Fields{"object": objectName})
+			s3IntegrityErrors.WithLabelValues(p.name).Inc()
+			return errors.New("Read content doesn't match the written content")
 		}
+		return nil
 	}
-	if err := p.mesureOperation("get_object", operation); err != nil {
+	if err := p.mesureSizedOperation("get_object", bucketName, objectSize, operation); err != nil {
 		return err
 	}
 
 	operation = func(ctx context.Context) error {
-		err := p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		info, err := p.endpoint.s3Client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+		if err != nil {
+			return err
+		}
+		if info.Size != objectSize {
+			return fmt.Errorf("Expected a size of %d bytes for %s but got %d", objectSize, objectName, info.Size)
+		}
+		return nil
+	}
+	if err := p.mesureSizedOperation("stat_object", bucketName, objectSize, operation); err != nil {
 		return err
 	}
-	if err := p.mesureOperation("remove_object", operation); err != nil {
+
+	if rangeSize := p.rangeGetLength(objectSize); rangeSize > 0 {
+		operation = func(ctx context.Context) error {
+			return p.rangeGetObject(ctx, bucketName, objectName, payload[:rangeSize])
+		}
+		if err := p.mesureSizedOperation("range_get", bucketName, objectSize, operation); err != nil {
+			return err
+		}
+	}
+
+	operation = func(ctx context.Context) error {
+		err := p.endpoint.s3Client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
 		return err
 	}
+	return p.mesureSizedOperation("remove_object", bucketName, objectSize, operation)
+}
 
+// rangeGetLength returns the number of bytes read by the range_get check on an object of the given size
+func (p *Probe) rangeGetLength(objectSize int64) int64 {
+	if p.rangeGetSize < objectSize {
+		return p.rangeGetSize
+	}
+	return objectSize
+}
+
+// rangeGetObject reads the first bytes of the object with a range request, endpoints
+// ignoring the range and returning the full object are reported as failures
+func (p *Probe) rangeGetObject(ctx context.Context, bucketName string, objectName string, expected []byte) error {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(0, int64(len(expected))-1); err != nil {
+		return err
+	}
+	obj, err := p.endpoint.s3Client.GetObject(ctx, bucketName, objectName, opts)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	data, err := ioutil.ReadAll(obj)
+	s3BytesDownloaded.WithLabelValues("range_get", p.name).Add(float64(len(data)))
+	if err != nil {
+		return err
+	}
+	if len(data) != len(expected) {
+		return fmt.Errorf("Expected %d bytes for the range of %s but got %d", len(expected), objectName, len(data))
+	}
+	if !bytes.Equal(data, expected) {
+		s3IntegrityErrors.WithLabelValues(p.name).Inc()
+		return fmt.Errorf("Range of %s read back with a different content than written", objectName)
+	}
 	return nil
 }
 
+// formatLatencyItemSizes formats the latency object sizes like the -latency-item-sizes flag
+func formatLatencyItemSizes(sizes []int64) string {
+	formatted := make([]string, len(sizes))
+	for i, size := range sizes {
+		formatted[i] = strconv.FormatInt(size, 10)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// parseLatencyItemSizes parses the comma separated list of latency object sizes,
+// the latency item size is used when the list is empty
+func parseLatencyItemSizes(sizes string, defaultSize int) ([]int64, error) {
+	if strings.TrimSpace(sizes) == "" {
+		return []int64{int64(defaultSize)}, nil
+	}
+	latencyItemSizes := []int64{}
+	for _, size := range strings.Split(sizes, ",") {
+		latencyItemSize, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || latencyItemSize <= 0 {
+			return nil, fmt.Errorf("Invalid latency item size: %q", size)
+		}
+		latencyItemSizes = append(latencyItemSizes, latencyItemSize)
+	}
+	return latencyItemSizes, nil
+}
+
 func (p *Probe) performGatewayChecks() error {
-	objectName, _ := randomHex(20)
+	objectName := p.randomObjectName()
 	objectSize := int64(1024)
 
 	objectData, _ := randomObject(objectSize)
@@ -294,23 +1150,23 @@ func (p *Probe) performGatewayChecks() error {
 		_, err := p.endpoint.s3Client.PutObject(ctx, p.gatewayBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
 		return err
 	}
-	if err := p.mesureOperation("gateway_put_object", operation); err != nil {
+	if err := p.mesureOperation("gateway_put_object", p.gatewayBucketName, operation); err != nil {
 		return err
 	}
 	var operationName string
 	for i := range p.gatewayEndpoints {
+		ctx, cancel := context.WithTimeout(p.ctx, p.latencyTimeout)
 		operationName = "gateway_get_object"
 		s3GatewayTotalCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
-		obj, err := p.gatewayEndpoints[i].s3Client.GetObject(context.Background(), p.gatewayBucketName, objectName, minio.GetObjectOptions{})
+		obj, err := p.gatewayEndpoints[i].s3Client.GetObject(ctx, p.gatewayBucketName, objectName, minio.GetObjectOptions{})
 		if err != nil {
-			log.Printf("Error while executing %s: %s", operationName, err)
+			p.log(InfoLevel, "Error while executing operation", Fields{"operation": operationName, "error": err})
 		} else {
-			// Read data by chunks of 1024 bytes
-			data := make([]byte, 1024)
-			for _, err = obj.Read(data); err == nil; {
-			}
-			if err != io.EOF {
-				log.Printf("Error while executing %s: %s", operationName, err)
+			data := getReadBuffer()
+			_, err = io.CopyBuffer(ioutil.Discard, obj, *data)
+			putReadBuffer(data)
+			if err != nil {
+				p.log(InfoLevel, "Error while executing operation", Fields{"operation": operationName, "error": err})
 			} else {
 				s3GatewaySuccessCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
 			}
@@ -319,160 +1175,218 @@ func (p *Probe) performGatewayChecks() error {
 
 		operationName = "gateway_remove_object"
 		s3GatewayTotalCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
-		err = p.gatewayEndpoints[i].s3Client.RemoveObject(context.Background(), p.gatewayBucketName, objectName, minio.RemoveObjectOptions{})
+		err = p.gatewayEndpoints[i].s3Client.RemoveObject(ctx, p.gatewayBucketName, objectName, minio.RemoveObjectOptions{})
 		if err != nil {
-			log.Printf("Error while executing %s: %s", operationName, err)
+			p.log(InfoLevel, "Error while executing operation", Fields{"operation": operationName, "error": err})
 		} else {
 			s3GatewaySuccessCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
 		}
+		cancel()
 	}
 
 	return nil
 }
 
-func (p *Probe) mesureOperation(operationName string, operation func(ctx context.Context) error) error {
+// mesureOperation runs the operation and records its latency and outcome, bucketName is
+// the bucket targeted by the operation (empty for operations not tied to a bucket)
+func (p *Probe) mesureOperation(operationName string, bucketName string, operation func(ctx context.Context) error) error {
+	return p.mesureSizedOperation(operationName, bucketName, 0, operation)
+}
+
+// mesureSizedOperation mesures an operation on an object of the given size, the size
+// is added to the latency metrics to break them down by payload size
+func (p *Probe) mesureSizedOperation(operationName string, bucketName string, objectSize int64, operation func(ctx context.Context) error) error {
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), p.latencyTimeout)
+	ctx, cancel := context.WithTimeout(p.ctx, p.latencyTimeout)
 	defer cancel()
 	err := operation(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		p.log(InfoLevel, "Timeout while executing operation", Fields{"operation": operationName, "timeout": p.latencyTimeout})
+		p.metrics.operationTimeouts.WithLabelValues(operationName, p.name, bucketName).Inc()
+	}
+	return p.recordOperation(operationName, bucketName, objectSize, start, err)
+}
 
-	s3TotalCounter.WithLabelValues(operationName, p.name).Inc()
-	s3LatencyHistogram.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
-	s3LatencySummary.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
+// recordOperation records the result and the latency of an operation started at start,
+// for operations made of several measured steps
+func (p *Probe) recordOperation(operationName string, bucketName string, objectSize int64, start time.Time, err error) error {
+	size := ""
+	if objectSize > 0 {
+		size = strconv.FormatInt(objectSize, 10)
+	}
+	p.metrics.totalCounter.WithLabelValues(operationName, p.name, bucketName).Inc()
+	if p.latencyMetric != "summary" {
+		p.metrics.latencyHistogram.WithLabelValues(operationName, p.name, bucketName, size).Observe(time.Since(start).Seconds())
+	}
+	if p.latencyMetric != "histogram" {
+		p.metrics.latencySummary.WithLabelValues(operationName, p.name, bucketName, size).Observe(time.Since(start).Seconds())
+	}
 
 	if err != nil {
-		log.Printf("Error while executing %s: %s", operationName, err)
+		p.log(InfoLevel, "Error while executing operation", Fields{"operation": operationName, "error": err})
+		p.metrics.requestErrors.WithLabelValues(operationName, p.name, bucketName, classifyError(err)).Inc()
 		return err
 	}
-	s3SuccessCounter.WithLabelValues(operationName, p.name).Inc()
+	p.metrics.successCounter.WithLabelValues(operationName, p.name, bucketName).Inc()
 	return nil
 }
 
-func (p *Probe) checkDurabilityBucketHasEnoughObject() (bool, error) {
-	var countObj = 0
-	// Create a done channel to control 'ListObjectsV2' go routine.
-	doneCh := make(chan struct{})
-
-	// Indicate to our routine to exit cleanly upon return.
-	defer close(doneCh)
-
-	objectCh := p.endpoint.s3Client.ListObjects(context.Background(), p.durabilityBucketName, minio.ListObjectsOptions{})
+// missingDurabilityItems lists the durability bucket and returns the indexes of the durability
+// items it lacks, e.g. when a previous seeding was interrupted
+func (p *Probe) missingDurabilityItems(ctx context.Context) ([]int, error) {
+	present := make([]bool, p.durabilityItemTotal)
+	objectCh := p.endpoint.s3Client.ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{})
 	for object := range objectCh {
 		if object.Err != nil {
-			return false, object.Err
+			return nil, object.Err
+		}
+		if !strings.HasPrefix(object.Key, durabilityObjectPrefix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(object.Key, durabilityObjectPrefix))
+		if err == nil && index >= 0 && index < p.durabilityItemTotal {
+			present[index] = true
 		}
-		countObj++
 	}
 
-	if countObj >= p.durabilityItemTotal {
-		return true, nil
+	missing := []int{}
+	for index, found := range present {
+		if !found {
+			missing = append(missing, index)
+		}
 	}
-	return false, nil
+	return missing, nil
 }
 
-func (p *Probe) prepareDurabilityBucket() error {
-	log.Printf("Checking if durability bucket is present on %s", p.name)
-	exists, errBucketExists := p.endpoint.s3Client.BucketExists(context.Background(), p.durabilityBucketName)
+func (p *Probe) prepareDurabilityBucket(ctx context.Context) error {
+	p.log(InfoLevel, "Checking if durability bucket is present", Fields{"bucket": p.durabilityBucketName})
+	exists, errBucketExists := bucketExists(p.endpoint.s3Client, p.durabilityBucketName)
 	if errBucketExists != nil {
 		return errBucketExists
 	}
 
-	if exists {
-		hasEnoughObjects, err := p.checkDurabilityBucketHasEnoughObject()
+	if !exists {
+		created, err := p.makeBucket(p.endpoint.s3Client, p.durabilityBucketName, minio.MakeBucketOptions{})
 		if err != nil {
 			return err
 		}
-		if hasEnoughObjects {
-			return nil
-		}
-	} else {
-		err := p.endpoint.s3Client.MakeBucket(context.Background(), p.durabilityBucketName, minio.MakeBucketOptions{})
+		exists = !created
+	}
+	missing := durabilityItemIndexes(p.durabilityItemTotal)
+	if exists {
+		var err error
+		missing, err = p.missingDurabilityItems(ctx)
 		if err != nil {
 			return err
 		}
+		if len(missing) == 0 {
+			p.setDurabilityReady()
+			return nil
+		}
+		// Only the missing items are written, so an interrupted seeding resumes where it stopped
+		p.log(WarnLevel, "Durability bucket is incomplete, backfilling the missing items", Fields{"bucket": p.durabilityBucketName,
+			"missing": len(missing), "total": p.durabilityItemTotal})
 	}
 
-	log.Println("Preparing durability bucket")
+	p.log(InfoLevel, "Preparing durability bucket", Fields{"bucket": p.durabilityBucketName})
 	probeBucketAttempt.WithLabelValues(p.name).Inc()
-	objectSuffix := "fake-item-"
-	objectSize := int64(p.durabilityItemSize)
-	objectData, _ := randomObject(objectSize)
+	if err := p.seedDurabilityItems(ctx, missing); err != nil {
+		return err
+	}
+	if exists {
+		probeSeedBackfilledItems.WithLabelValues(p.name).Add(float64(len(missing)))
+	}
+	p.setDurabilityReady()
+	return nil
+}
 
-	var objectName string
-	for i := 0; i < p.durabilityItemTotal; i++ {
-		objectName = objectSuffix + strconv.Itoa(i)
-		_, err := p.endpoint.s3Client.PutObject(context.Background(), p.durabilityBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+func (p *Probe) isDurabilityReady() bool {
+	return atomic.LoadInt32(&p.durabilityReady) == 1
+}
 
-		for err != nil {
-			log.Printf("Error (item: %d): %s, retrying in (5s)", i, err)
-			time.Sleep(5 * time.Second)
-			_, err = p.endpoint.s3Client.PutObject(context.Background(), p.durabilityBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
-		}
-		if i%100 == 0 {
-			log.Printf("%s> %d objects written (%d%%)", p.name, i, int((float64(i)/float64(p.durabilityItemTotal))*100))
+// setDurabilityReady marks the durability bucket as seeded enough to start reporting durability
+func (p *Probe) setDurabilityReady() {
+	atomic.StoreInt32(&p.durabilityReady, 1)
+	p.metrics.durabilityReady.WithLabelValues(p.name).Set(1)
+}
+
+func (p *Probe) prepareLatencyBucket() error {
+	for _, bucketName := range p.latencyBucketNames() {
+		if err := p.prepareLatencyBucketNamed(bucketName); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (p *Probe) prepareLatencyBucket() error {
-	log.Printf("Checking if latency bucket is present on %s", p.name)
-	exists, errBucketExists := p.endpoint.s3Client.BucketExists(context.Background(), p.latencyBucketName)
+func (p *Probe) prepareLatencyBucketNamed(bucketName string) error {
+	p.log(InfoLevel, "Checking if latency bucket is present", Fields{"bucket": bucketName})
+	exists, errBucketExists := bucketExists(p.endpoint.s3Client, bucketName)
 	if errBucketExists != nil {
 		return errBucketExists
 	}
 	if exists {
 		return nil
 	}
-	log.Println("Preparing latency bucket")
+	p.log(InfoLevel, "Preparing latency bucket", Fields{"bucket": bucketName})
 	probeBucketAttempt.WithLabelValues(p.name).Inc()
 
-	err := p.endpoint.s3Client.MakeBucket(context.Background(), p.latencyBucketName, minio.MakeBucketOptions{})
-	if err != nil {
+	created, err := p.makeBucket(p.endpoint.s3Client, bucketName, minio.MakeBucketOptions{})
+	if err != nil || !created {
 		return err
 	}
 
-	setBucketLifecycle1d(p.endpoint.s3Client, p.latencyBucketName)
+	p.setBucketLifecycle(p.endpoint.s3Client, bucketName)
 	return nil
 }
 
 func (p *Probe) prepareGatewayBucket() error {
-	log.Printf("Checking if gateway buckets are present on %s", p.name)
+	p.log(InfoLevel, "Checking if gateway buckets are present", Fields{"bucket": p.gatewayBucketName})
 	if len(p.gatewayEndpoints) == 0 {
 		return errors.New("Couldn't find any gateway destinations")
 	}
 	for i := range p.gatewayEndpoints {
-		exists, errBucketExists := p.gatewayEndpoints[i].s3Client.BucketExists(context.Background(), p.gatewayBucketName)
+		exists, errBucketExists := bucketExists(p.gatewayEndpoints[i].s3Client, p.gatewayBucketName)
 		if errBucketExists != nil {
 			return errBucketExists
 		}
 		if exists {
 			continue
 		}
-		log.Printf("Preparing gateway bucket on %s", p.gatewayEndpoints[i].Name)
+		p.log(InfoLevel, "Preparing gateway bucket", Fields{"bucket": p.gatewayBucketName, "gateway": p.gatewayEndpoints[i].Name})
 		probeGatewayBucketAttempt.WithLabelValues(p.name, p.gatewayEndpoints[i].Name).Inc()
 
-		err := p.gatewayEndpoints[i].s3Client.MakeBucket(context.Background(), p.gatewayBucketName, minio.MakeBucketOptions{})
+		created, err := p.makeBucket(p.gatewayEndpoints[i].s3Client, p.gatewayBucketName, minio.MakeBucketOptions{})
 		if err != nil {
 			return err
 		}
-		setBucketLifecycle1d(p.gatewayEndpoints[i].s3Client, p.gatewayBucketName)
+		if !created {
+			continue
+		}
+		p.setBucketLifecycle(p.gatewayEndpoints[i].s3Client, p.gatewayBucketName)
 	}
 	return nil
 }
 
-func setBucketLifecycle1d(client *minio.Client, bucketName string) {
+// setBucketLifecycle expires the objects the probe failed to remove after lifecycleExpirationDays
+// days (0 disables the lifecycle rule). A rejected lifecycle is logged without failing the preparation
+func (p *Probe) setBucketLifecycle(client S3Client, bucketName string) {
+	if p.lifecycleExpirationDays == 0 {
+		return
+	}
 	lc := lifecycle.NewConfiguration()
 	lc.Rules = []lifecycle.Rule{
 		{
 			ID:     "expire-bucket",
 			Status: "Enabled",
 			Expiration: lifecycle.Expiration{
-				Days: 1,
+				Days: lifecycle.ExpirationDays(p.lifecycleExpirationDays),
 			},
 		},
 	}
-	client.SetBucketLifecycle(context.Background(), bucketName, lc)
+	if err := client.SetBucketLifecycle(context.Background(), bucketName, lc); err != nil {
+		p.log(WarnLevel, "Lifecycle of bucket was rejected by the endpoint", Fields{"bucket": bucketName, "error": err})
+	}
 }
 
 func randomHex(n int) (string, error) {
@@ -484,9 +1398,34 @@ func randomHex(n int) (string, error) {
 }
 
 func randomObject(n int64) (io.Reader, error) {
+	buffer, err := randomPayload(n)
+	return bytes.NewReader(buffer), err
+}
+
+// randomPayload returns n random bytes, for checks that need to compare what they read with what they wrote
+func randomPayload(n int64) ([]byte, error) {
 	buffer := make([]byte, n)
-	if _, err := rand.Read(buffer); err != nil {
-		return bytes.NewReader(buffer), err
+	_, err := rand.Read(buffer)
+	return buffer, err
+}
+
+var sharedPayloadsMutex sync.Mutex
+var sharedPayloads = map[int64][]byte{}
+
+// sharedPayload returns n random bytes generated once per size, for the seeding of the durability
+// items. The payload is shared and must not be modified: uploads read it through their own reader
+// (e.g. bytes.NewReader) which can't be consumed by others. Checks comparing what they read with
+// what they wrote must use randomPayload, so that reading another object of the same size fails
+func sharedPayload(n int64) ([]byte, error) {
+	sharedPayloadsMutex.Lock()
+	defer sharedPayloadsMutex.Unlock()
+	if payload, ok := sharedPayloads[n]; ok {
+		return payload, nil
+	}
+	payload, err := randomPayload(n)
+	if err != nil {
+		return nil, err
 	}
-	return bytes.NewReader(buffer), nil
+	sharedPayloads[n] = payload
+	return payload, nil
 }
@@ -1,14 +1,21 @@
 package probe
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/criteo/s3-probe/config"
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
 func TestPrepareBucketCreateBucketIfNotExists(t *testing.T) {
@@ -32,7 +39,7 @@ func TestPrepareBucketCreateBucketIfNotExists(t *testing.T) {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
 
-	err = probe.prepareDurabilityBucket()
+	err = probe.prepareDurabilityBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -45,7 +52,7 @@ func TestPrepareBucketFailedIfNotAuth(t *testing.T) {
 		Creds:  creds,
 		Secure: false,
 	})
-	probe.endpoint.s3Client = client
+	probe.endpoint.s3Client = newMinioS3Client(client)
 
 	suffix, _ := randomHex(8)
 	probe.latencyBucketName = probe.latencyBucketName + suffix
@@ -61,7 +68,7 @@ func TestPerformLatencyCheckSuccess(t *testing.T) {
 	probe.latencyBucketName = probe.latencyBucketName + suffix
 	probe.durabilityBucketName = probe.durabilityBucketName + suffix
 	probe.durabilityItemTotal = 10
-	err := probe.prepareDurabilityBucket()
+	err := probe.prepareDurabilityBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -71,6 +78,22 @@ func TestPerformLatencyCheckSuccess(t *testing.T) {
 	}
 }
 
+func TestPerformLatencyCheckWithNastyObjectNames(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.objectNameCharset = "nasty"
+	probe.objectNameLength = 200
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performLatencyChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
 func TestPerformLatencyCheckFailWithTimeout(t *testing.T) {
 	probe, _ := getTestProbe()
 	suffix, _ := randomHex(8)
@@ -107,16 +130,13 @@ func TestPrepareProbingProperlyTerminate(t *testing.T) {
 	suffix, _ := randomHex(8)
 	bucket := probe.latencyBucketName
 	probe.latencyBucketName = "/./??.."
-	err := probe.PrepareProbing()
+	err := probe.PrepareProbing(context.Background())
 	if err == nil {
 		t.Errorf("Preparation errors are not properly handled: %s", err)
 	}
 	probe.latencyBucketName = bucket + suffix
-	controlChan := probe.controlChan
-
-	controlChan <- false
 
-	err = probe.PrepareProbing()
+	err = probe.PrepareProbing(context.Background())
 	if err != nil {
 		t.Errorf("Probing is failing: %s", err)
 	}
@@ -126,7 +146,7 @@ func getTestProbe() (Probe, error) {
 	endpoint := config.GetEnv("S3_ENDPOINT_ADDR", "localhost:9000")
 	service := S3Service{Name: "test", Gateway: false}
 	testConfig := config.GetTestConfig()
-	probe, err := NewProbe(service, endpoint, []S3Endpoint{}, &testConfig, make(chan bool, 1))
+	probe, err := NewProbe(service, endpoint, []S3Endpoint{}, &testConfig)
 	if err != nil {
 		log.Fatalf("Error while creating test env: %s", err)
 	}
@@ -179,11 +199,870 @@ func TestPerformGatewayCheckSuccess(t *testing.T) {
 	}
 }
 
+func TestPerformVersioningCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.versioningBucketName = probe.versioningBucketName + suffix
+	err := probe.prepareVersioningBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performVersioningChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestPerformContentMD5CheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.sendContentMD5 = true
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performLatencyChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+	err = probe.performContentMD5Checks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestPerformEdgeCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	edgeEndpoint := probe.endpoint
+	probe.edgeEndpoint = &edgeEndpoint
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performEdgeChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestPerformLargeStatCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performLargeStatChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestPerformMultipartCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performMultipartChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("multipart_put", probe.name, probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful multipart_put got %f", *metric.Counter.Value)
+	}
+}
+
+func TestPerformOverwriteCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performOverwriteChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestPerformOverwriteCheckOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("overwrite-memory")
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performOverwriteChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("overwrite_put_object", "overwrite-memory", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != float64(probe.overwriteCount) {
+		t.Errorf("Expected %d overwrites got %f", probe.overwriteCount, *metric.Counter.Value)
+	}
+	for object := range probe.endpoint.s3Client.ListObjects(context.Background(), probe.latencyBucketName, minio.ListObjectsOptions{}) {
+		t.Errorf("Overwritten object %s was not removed", object.Key)
+	}
+}
+
+func TestPerformCopyCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performCopyChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestPerformCopyCheckOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("copy-memory")
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performCopyChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("copy_object", "copy-memory", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful copy_object got %f", *metric.Counter.Value)
+	}
+	for object := range probe.endpoint.s3Client.ListObjects(context.Background(), probe.latencyBucketName, minio.ListObjectsOptions{}) {
+		t.Errorf("Copied object %s was not removed", object.Key)
+	}
+}
+
+func TestPerformMultipartCheckAbortsOnFailure(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	// Parts below 5MiB are rejected by S3 when completing the upload
+	probe.multipartPartSize = 1024
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performMultipartChecks()
+	if err == nil {
+		t.Errorf("Multipart check should have failed with too small parts")
+	}
+
+	uploads, err := probe.endpoint.s3Client.ListMultipartUploads(context.Background(), probe.latencyBucketName, "", 10)
+	if err != nil {
+		t.Errorf("Listing multipart uploads failed: %s", err)
+	}
+	if len(uploads.Uploads) != 0 {
+		t.Errorf("Failed multipart upload was not aborted")
+	}
+}
+
+func TestPerformMultipartCheckRecordsFailedPut(t *testing.T) {
+	// Multipart uploads are not implemented by the in-memory backend
+	probe := getMemoryTestProbe("multipart-put-failure")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performMultipartChecks(); err == nil {
+		t.Errorf("Multipart check should fail on the in-memory backend")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3TotalCounter.WithLabelValues("multipart_put", "multipart-put-failure", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 multipart_put got %f", *metric.Counter.Value)
+	}
+	s3SuccessCounter.WithLabelValues("multipart_put", "multipart-put-failure", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("Expected no successful multipart_put got %f", *metric.Counter.Value)
+	}
+}
+
+func TestPerformUsageCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	probe.usageFetcher, _ = getUsageFetcher("listing")
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performUsageChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
+func TestNewProbeFailsWithUnknownUsageFetcher(t *testing.T) {
+	cfg := config.GetTestConfig()
+	fetcher := "unknown"
+	cfg.UsageFetcher = &fetcher
+	_, err := NewProbe(S3Service{Name: "test"}, "localhost:9000", []S3Endpoint{}, &cfg)
+	if err == nil {
+		t.Errorf("Probe creation should fail with an unknown usage fetcher")
+	}
+
+	RegisterUsageFetcher("unknown", listingUsageFetcher)
+	_, err = NewProbe(S3Service{Name: "test"}, "localhost:9000", []S3Endpoint{}, &cfg)
+	if err != nil {
+		t.Errorf("Probe creation should succeed with a registered usage fetcher: %s", err)
+	}
+}
+
+func TestPerformDurabilityCheckWaitsForReadiness(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	err := probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if !probe.isDurabilityReady() {
+		t.Errorf("Durability should be ready once the bucket is seeded")
+	}
+
+	probe.durabilityReady = 0
+	probe.durabilityItemTotal = 20
+	err = probe.performDurabilityChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+	if probe.isDurabilityReady() {
+		t.Errorf("Durability shouldn't be ready with half of the items seeded")
+	}
+
+	probe.durabilityReadyThreshold = 0.5
+	err = probe.performDurabilityChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+	if !probe.isDurabilityReady() {
+		t.Errorf("Durability should be ready once the threshold is reached")
+	}
+}
+
+func TestNewProbeFailsWithInvalidReadyThreshold(t *testing.T) {
+	cfg := config.GetTestConfig()
+	threshold := 1.5
+	cfg.DurabilityReadyThreshold = &threshold
+	_, err := NewProbe(S3Service{Name: "test"}, "localhost:9000", []S3Endpoint{}, &cfg)
+	if err == nil {
+		t.Errorf("Probe creation should fail with a threshold above 1")
+	}
+}
+
+func TestNewProbeFailsWithInvalidRates(t *testing.T) {
+	for _, rate := range []int{0, -1, 60001} {
+		cfg := config.GetTestConfig()
+		probeRate := rate
+		cfg.ProbeRatePerMin = &probeRate
+		if _, err := NewProbe(S3Service{Name: "test"}, "localhost:9000", []S3Endpoint{}, &cfg); err == nil {
+			t.Errorf("Probe creation should fail with a probe rate of %d", rate)
+		}
+	}
+
+	cfg := config.GetTestConfig()
+	multipartRate := -1
+	cfg.MultipartProbeRatePerMin = &multipartRate
+	if _, err := NewProbe(S3Service{Name: "test"}, "localhost:9000", []S3Endpoint{}, &cfg); err == nil {
+		t.Errorf("Probe creation should fail with a negative multipart probe rate")
+	}
+
+	cfg = config.GetTestConfig()
+	itemTotal := 0
+	cfg.DurabilityItemTotal = &itemTotal
+	if _, err := NewProbe(S3Service{Name: "test"}, "localhost:9000", []S3Endpoint{}, &cfg); err == nil {
+		t.Errorf("Probe creation should fail without durability items")
+	}
+}
+
+func TestPerformObjectLockCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.objectLockBucketName = probe.objectLockBucketName + suffix
+	probe.objectLockProbe = true
+	err := probe.prepareObjectLockBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if !probe.objectLockProbe {
+		t.Skip("Object Lock is not supported by the test endpoint")
+	}
+	err = probe.performObjectLockChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+}
+
 func TestTimerReturnAFakeTimer(t *testing.T) {
-	ticker := newTimer(0)
+	ticker := newTimer(0, 0.1)
 	if ticker.Ticker != nil {
 		t.Errorf("Fake ticker doesn't work")
 	}
 
 	ticker.Stop()
 }
+
+func TestJitterIntervalStaysWithinJitter(t *testing.T) {
+	interval := time.Second
+	total := time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		jittered := jitterInterval(interval, 0.1)
+		if jittered < 900*time.Millisecond || jittered > 1100*time.Millisecond {
+			t.Errorf("Expected an interval within 10%% of 1s got %s", jittered)
+		}
+		total += jittered
+	}
+	if average := total / 1000; average < 980*time.Millisecond || average > 1020*time.Millisecond {
+		t.Errorf("Expected an average interval close to 1s got %s", average)
+	}
+}
+
+func TestJitteredTimerTicks(t *testing.T) {
+	ticker := newTimer(600, 0.5)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C:
+	case <-time.After(time.Second):
+		t.Errorf("Jittered timer didn't tick")
+	}
+}
+
+func TestHeartbeatWhenOperationsFail(t *testing.T) {
+	// Buckets are not prepared so every operation fails
+	probe := getMemoryTestProbe("heartbeat-failing")
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	probe.StartProbing(ctx)
+
+	metric := &io_prometheus_client.Metric{}
+	s3ProbeHeartbeat.WithLabelValues("heartbeat-failing").Write(metric)
+	if *metric.Counter.Value < 2 {
+		t.Errorf("Expected at least 2 heartbeats got %f", *metric.Counter.Value)
+	}
+	s3SuccessCounter.WithLabelValues("put_object", "heartbeat-failing", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("Expected no successful operation got %f", *metric.Counter.Value)
+	}
+}
+
+func TestPerformDurabilityCheckReportsMissingItems(t *testing.T) {
+	probe := getMemoryTestProbe("durability-missing")
+	probe.durabilitySampleSize = probe.durabilityItemTotal
+	err := probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performDurabilityChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+
+	probe.endpoint.s3Client.RemoveObject(context.Background(), probe.durabilityBucketName, durabilityObjectName(3), minio.RemoveObjectOptions{})
+	err = probe.performDurabilityChecks()
+	if err == nil {
+		t.Errorf("Durability check should fail when an item is missing")
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3MissingDurabilityItems.WithLabelValues("durability-missing").Write(metric)
+	if *metric.Gauge.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Gauge.Value)
+	}
+	s3SuccessCounter.WithLabelValues("durability_get", "durability-missing", probe.durabilityBucketName).Write(metric)
+	if *metric.Counter.Value != float64(2*probe.durabilityItemTotal-1) {
+		t.Errorf("Expected %d successful reads got %f", 2*probe.durabilityItemTotal-1, *metric.Counter.Value)
+	}
+}
+
+func TestParseLatencyItemSizes(t *testing.T) {
+	sizes, err := parseLatencyItemSizes("", 1024)
+	if err != nil || len(sizes) != 1 || sizes[0] != 1024 {
+		t.Errorf("Expected [1024] got %v (%v)", sizes, err)
+	}
+	sizes, err = parseLatencyItemSizes("1024, 1048576", 10)
+	if err != nil || len(sizes) != 2 || sizes[1] != 1048576 {
+		t.Errorf("Expected [1024 1048576] got %v (%v)", sizes, err)
+	}
+	if _, err = parseLatencyItemSizes("1024,abc", 10); err == nil {
+		t.Errorf("Invalid sizes should be rejected")
+	}
+	if _, err = parseLatencyItemSizes("0", 10); err == nil {
+		t.Errorf("Null sizes should be rejected")
+	}
+}
+
+func TestPerformLatencyCheckWithSizesOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("latency-sizes")
+	probe.latencyItemSizes = []int64{10, 2048}
+	err := probe.prepareLatencyBucket()
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performLatencyChecks()
+	if err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+
+	for _, size := range []string{"10", "2048"} {
+		metric := &io_prometheus_client.Metric{}
+		s3LatencySummary.WithLabelValues("get_object", "latency-sizes", probe.latencyBucketName, size).(prometheus.Metric).Write(metric)
+		if *metric.Summary.SampleCount != 1 {
+			t.Errorf("Expected 1 get_object of %s bytes got %d", size, *metric.Summary.SampleCount)
+		}
+		metric = &io_prometheus_client.Metric{}
+		s3LatencySummary.WithLabelValues("stat_object", "latency-sizes", probe.latencyBucketName, size).(prometheus.Metric).Write(metric)
+		if *metric.Summary.SampleCount != 1 {
+			t.Errorf("Expected 1 stat_object of %s bytes got %d", size, *metric.Summary.SampleCount)
+		}
+		metric = &io_prometheus_client.Metric{}
+		s3GetObjectBytesRead.WithLabelValues("latency-sizes", probe.latencyBucketName, size).Write(metric)
+		if strconv.FormatFloat(*metric.Gauge.Value, 'f', -1, 64) != size {
+			t.Errorf("Expected %s bytes read got %f", size, *metric.Gauge.Value)
+		}
+	}
+}
+
+func TestConfigureLatencyHistogram(t *testing.T) {
+	defaultHistogram := s3LatencyHistogram
+	defer func() {
+		prometheus.Unregister(s3LatencyHistogram)
+		prometheus.MustRegister(defaultHistogram)
+		s3LatencyHistogram = defaultHistogram
+	}()
+
+	if err := ConfigureLatencyHistogram("0.5,0.1"); err == nil {
+		t.Errorf("Unsorted buckets should be rejected")
+	}
+	if err := ConfigureLatencyHistogram("0.1,abc"); err == nil {
+		t.Errorf("Invalid buckets should be rejected")
+	}
+	if err := ConfigureLatencyHistogram("0.1, 1"); err != nil {
+		t.Errorf("Histogram configuration failed: %s", err)
+	}
+
+	probe := getMemoryTestProbe("latency-histogram")
+	probe.latencyMetric = "histogram"
+	probe.mesureOperation("list_buckets", "", func(ctx context.Context) error { return nil })
+
+	metric := &io_prometheus_client.Metric{}
+	s3LatencyHistogram.WithLabelValues("list_buckets", "latency-histogram", "", "").(prometheus.Metric).Write(metric)
+	if len(metric.Histogram.Bucket) != 2 || *metric.Histogram.SampleCount != 1 {
+		t.Errorf("Expected 1 sample in 2 buckets got %v", metric.Histogram)
+	}
+	metric = &io_prometheus_client.Metric{}
+	s3LatencySummary.WithLabelValues("list_buckets", "latency-histogram", "", "").(prometheus.Metric).Write(metric)
+	if *metric.Summary.SampleCount != 0 {
+		t.Errorf("Summary should not be recorded with the histogram latency metric")
+	}
+}
+
+func TestPrepareDurabilityBucketWithSeedWorkers(t *testing.T) {
+	probe := getMemoryTestProbe("seed-workers")
+	probe.seedWorkers = 4
+	probe.durabilityItemTotal = 250
+	if err := probe.prepareDurabilityBucket(context.Background()); err != nil {
+		t.Errorf("Durability bucket preparation failed: %s", err)
+	}
+	for i := 0; i < probe.durabilityItemTotal; i++ {
+		_, err := probe.endpoint.s3Client.StatObject(context.Background(), probe.durabilityBucketName, durabilityObjectName(i), minio.StatObjectOptions{})
+		if err != nil {
+			t.Errorf("Durability item %d was not written: %s", i, err)
+		}
+	}
+	if !probe.isDurabilityReady() {
+		t.Errorf("Durability should be ready once seeded")
+	}
+}
+
+// hangingS3Client mimics a blackholed endpoint: writes only return once their context is done
+type hangingS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *hangingS3Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	<-ctx.Done()
+	return minio.UploadInfo{}, ctx.Err()
+}
+
+func TestOperationTimeoutIsRecordedAsFailure(t *testing.T) {
+	probe := getMemoryTestProbe("operation-timeout")
+	probe.endpoint.s3Client = &hangingS3Client{NewMemoryS3Client()}
+	probe.latencyTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	if err := probe.performLatencyChecks(); err == nil {
+		t.Errorf("Latency check should fail on a hanging endpoint")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Latency check should fail within the timeout, took %s", elapsed)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3OperationTimeouts.WithLabelValues("put_object", "operation-timeout", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 put_object timeout got %f", *metric.Counter.Value)
+	}
+	s3TotalCounter.WithLabelValues("put_object", "operation-timeout", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 put_object got %f", *metric.Counter.Value)
+	}
+	s3SuccessCounter.WithLabelValues("put_object", "operation-timeout", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("Expected no successful put_object got %f", *metric.Counter.Value)
+	}
+}
+
+// corruptingS3Client mimics an endpoint silently corrupting the objects it stores
+type corruptingS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *corruptingS3Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	data[0]++
+	return c.MemoryS3Client.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), objectSize, opts)
+}
+
+func TestLatencyCheckDetectsCorruptedContent(t *testing.T) {
+	probe := getMemoryTestProbe("integrity")
+	probe.endpoint.s3Client = &corruptingS3Client{NewMemoryS3Client()}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err == nil {
+		t.Errorf("Latency check should fail on corrupted content")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3IntegrityErrors.WithLabelValues("integrity").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 integrity error got %f", *metric.Counter.Value)
+	}
+}
+
+func TestLatencyCheckListsDurabilityObjects(t *testing.T) {
+	probe := getMemoryTestProbe("list-objects")
+	probe.listObjectsMaxKeys = 4
+	if err := probe.PrepareProbing(context.Background()); err != nil {
+		t.Errorf("Probe preparation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err != nil {
+		t.Errorf("Latency check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3ListObjectsKeys.WithLabelValues("list-objects", probe.durabilityBucketName).Write(metric)
+	if *metric.Gauge.Value != 4 {
+		t.Errorf("Expected 4 keys listed got %f", *metric.Gauge.Value)
+	}
+	s3SuccessCounter.WithLabelValues("list_objects", "list-objects", probe.durabilityBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful list_objects got %f", *metric.Counter.Value)
+	}
+}
+
+// failingListS3Client mimics an endpoint failing every listing
+type failingListS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *failingListS3Client) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	objectCh := make(chan minio.ObjectInfo, 1)
+	objectCh <- minio.ObjectInfo{Err: minio.ErrorResponse{Code: "InternalError", StatusCode: 500}}
+	close(objectCh)
+	return objectCh
+}
+
+func TestLatencyCheckGoesOnAfterListObjectsFailure(t *testing.T) {
+	probe := getMemoryTestProbe("list-objects-failure")
+	probe.listObjectsMaxKeys = 4
+	probe.endpoint.s3Client = &failingListS3Client{NewMemoryS3Client()}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Probe preparation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err == nil {
+		t.Errorf("Latency check should fail when the listing fails")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("put_object", "list-objects-failure", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value == 0 {
+		t.Errorf("Object operations should still be measured after a failed listing")
+	}
+}
+
+// truncatingStatS3Client mimics an endpoint reporting a wrong size on HEAD
+type truncatingStatS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *truncatingStatS3Client) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	info, err := c.MemoryS3Client.StatObject(ctx, bucketName, objectName, opts)
+	info.Size--
+	return info, err
+}
+
+func TestLatencyCheckFailsOnStatSizeMismatch(t *testing.T) {
+	probe := getMemoryTestProbe("stat-size")
+	probe.endpoint.s3Client = &truncatingStatS3Client{NewMemoryS3Client()}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err == nil {
+		t.Errorf("Latency check should fail when the stat size doesn't match")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("stat_object", "stat-size", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("Expected no successful stat_object got %f", *metric.Counter.Value)
+	}
+}
+
+func TestNewProbeSetsProbeInfo(t *testing.T) {
+	probe := getMemoryTestProbe("probe-info")
+	metric := &io_prometheus_client.Metric{}
+	s3ProbeInfo.WithLabelValues("probe-info", "probe-info", "memory", "false", "", "auto", "30s", "10s", "16", "true", "120", "10", strconv.Itoa(probe.latencyItemSize)).Write(metric)
+	if *metric.Gauge.Value != 1 {
+		t.Errorf("Expected the probe info to be set got %f", *metric.Gauge.Value)
+	}
+}
+
+func TestLatencyCheckCountsTransferredBytes(t *testing.T) {
+	probe := getMemoryTestProbe("transferred-bytes")
+	probe.latencyItemSizes = []int64{10, 2048}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err != nil {
+		t.Errorf("Probe check is failing: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3BytesUploaded.WithLabelValues("put_object", "transferred-bytes").Write(metric)
+	if *metric.Counter.Value != 2058 {
+		t.Errorf("Expected 2058 bytes uploaded got %f", *metric.Counter.Value)
+	}
+	s3BytesDownloaded.WithLabelValues("get_object", "transferred-bytes").Write(metric)
+	if *metric.Counter.Value != 2058 {
+		t.Errorf("Expected 2058 bytes downloaded got %f", *metric.Counter.Value)
+	}
+}
+
+// rangeIgnoringS3Client mimics a gateway returning the full object on range requests
+type rangeIgnoringS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *rangeIgnoringS3Client) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error) {
+	return c.MemoryS3Client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+}
+
+func TestLatencyCheckPerformsRangeGet(t *testing.T) {
+	probe := getMemoryTestProbe("range-get")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err != nil {
+		t.Errorf("Latency check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("range_get", "range-get", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful range_get got %f", *metric.Counter.Value)
+	}
+	s3BytesDownloaded.WithLabelValues("range_get", "range-get").Write(metric)
+	if *metric.Counter.Value != float64(probe.rangeGetLength(int64(probe.latencyItemSize))) {
+		t.Errorf("Expected %d bytes downloaded got %f", probe.rangeGetLength(int64(probe.latencyItemSize)), *metric.Counter.Value)
+	}
+}
+
+func TestLatencyCheckFailsWhenRangeIsIgnored(t *testing.T) {
+	probe := getMemoryTestProbe("range-ignored")
+	probe.endpoint.s3Client = &rangeIgnoringS3Client{NewMemoryS3Client()}
+	// The range must be smaller than the object to tell it from the full object
+	probe.rangeGetSize = 4
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err == nil {
+		t.Errorf("Latency check should fail when the range is ignored")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("range_get", "range-ignored", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("Expected no successful range_get got %f", *metric.Counter.Value)
+	}
+}
+
+func TestLatencyCheckProbesEveryLatencyBucket(t *testing.T) {
+	testConfig := config.GetTestConfig()
+	backend := "memory"
+	testConfig.Backend = &backend
+	latencyBuckets := "latency-a, latency-b"
+	testConfig.LatencyBucketName = &latencyBuckets
+	probe, err := NewProbe(S3Service{Name: "latency-buckets"}, "latency-buckets", []S3Endpoint{}, &testConfig)
+	if err != nil {
+		t.Fatalf("Error while creating test env: %s", err)
+	}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performLatencyChecks(); err != nil {
+		t.Errorf("Latency check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	for _, bucketName := range []string{"latency-a", "latency-b"} {
+		s3SuccessCounter.WithLabelValues("put_object", "latency-buckets", bucketName).Write(metric)
+		if *metric.Counter.Value != 1 {
+			t.Errorf("Expected 1 successful put_object on %s got %f", bucketName, *metric.Counter.Value)
+		}
+	}
+}
+
+// payloadRecordingS3Client records the bodies of the uploads
+type payloadRecordingS3Client struct {
+	*MemoryS3Client
+	payloads [][]byte
+}
+
+func (c *payloadRecordingS3Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	c.payloads = append(c.payloads, data)
+	return c.MemoryS3Client.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), objectSize, opts)
+}
+
+func TestLatencyCheckWritesFreshPayloads(t *testing.T) {
+	probe := getMemoryTestProbe("fresh-payloads")
+	client := &payloadRecordingS3Client{MemoryS3Client: NewMemoryS3Client()}
+	probe.endpoint.s3Client = client
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := probe.performSizedLatencyChecks(probe.latencyBucketName, 64); err != nil {
+			t.Errorf("Latency check failed: %s", err)
+		}
+	}
+	if len(client.payloads) != 2 {
+		t.Fatalf("Expected 2 uploads got %d", len(client.payloads))
+	}
+	// Reading another object of the same size must not pass the content check
+	if bytes.Equal(client.payloads[0], client.payloads[1]) {
+		t.Errorf("Latency objects should be written with a new payload on every run")
+	}
+}
+
+// laggingEdgeS3Client mimics an edge not finding the objects during its first polls
+type laggingEdgeS3Client struct {
+	*MemoryS3Client
+	lag int
+}
+
+func (c *laggingEdgeS3Client) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	if c.lag > 0 {
+		c.lag--
+		return minio.ObjectInfo{}, memoryError("NoSuchKey", http.StatusNotFound, bucketName, objectName)
+	}
+	return c.MemoryS3Client.StatObject(ctx, bucketName, objectName, opts)
+}
+
+func TestEdgeCheckDoesNotMeasureLagAsColdRead(t *testing.T) {
+	probe := getMemoryTestProbe("edge-lag")
+	probe.edgeLagTimeout = time.Second
+	client := &laggingEdgeS3Client{MemoryS3Client: probe.endpoint.s3Client.(*MemoryS3Client), lag: 2}
+	probe.edgeEndpoint = &S3Endpoint{Name: "edge", s3Client: client}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	if err := probe.performEdgeChecks(); err != nil {
+		t.Errorf("Edge check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3EdgeNotFoundCounter.WithLabelValues("edge-lag", "edge").Write(metric)
+	if *metric.Counter.Value != 2 {
+		t.Errorf("Expected 2 polls not finding the object got %f", *metric.Counter.Value)
+	}
+	s3EdgeTotalCounter.WithLabelValues("edge-lag", "edge", "cold").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 cold read got %f", *metric.Counter.Value)
+	}
+	s3EdgeSuccessCounter.WithLabelValues("edge-lag", "edge", "cold").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful cold read got %f", *metric.Counter.Value)
+	}
+}
+
+func TestLargeStatCheckWritesLargeObject(t *testing.T) {
+	probe := getMemoryTestProbe("large-stat")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := probe.performLargeStatChecks(); err != nil {
+			t.Errorf("Large stat check failed: %s", err)
+		}
+	}
+
+	info, err := probe.endpoint.s3Client.StatObject(context.Background(), probe.latencyBucketName, probe.largeStatObject, minio.StatObjectOptions{})
+	if err != nil || info.Size != probe.largeStatSize {
+		t.Errorf("Expected a large object of %d bytes got %d (%v)", probe.largeStatSize, info.Size, err)
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("stat_large_put_object", "large-stat", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected the large object to be written once got %f", *metric.Counter.Value)
+	}
+	s3SuccessCounter.WithLabelValues("stat_large_object", "large-stat", probe.latencyBucketName).Write(metric)
+	if expected := float64(2 * probe.largeStatSamples); *metric.Counter.Value != expected {
+		t.Errorf("Expected %f stat_large_object got %f", expected, *metric.Counter.Value)
+	}
+}
+
+func TestMedianDuration(t *testing.T) {
+	if median := medianDuration([]time.Duration{3, 100, 1}); median != 3 {
+		t.Errorf("Expected 3 got %d", median)
+	}
+	if median := medianDuration([]time.Duration{4, 1, 2, 100}); median != 3 {
+		t.Errorf("Expected 3 got %d", median)
+	}
+}
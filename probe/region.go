@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"net/http"
+	"sync"
+)
+
+var servedRegionsMutex sync.Mutex
+var servedRegions = map[string]string{}
+
+// regionTransport records the region reported by the endpoint in the response headers
+// to detect requests silently routed to another region than the configured one
+type regionTransport struct {
+	http.RoundTripper
+	address          string
+	header           string
+	configuredRegion string
+}
+
+func newRegionTransport(transport http.RoundTripper, address string, header string, configuredRegion string) *regionTransport {
+	return &regionTransport{RoundTripper: transport, address: address, header: header, configuredRegion: configuredRegion}
+}
+
+func (t *regionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	// Endpoints may not send the header at all or only on some responses
+	if region := resp.Header.Get(t.header); region != "" {
+		recordServedRegion(t.address, t.configuredRegion, region)
+	}
+	return resp, nil
+}
+
+func recordServedRegion(address string, configuredRegion string, region string) {
+	servedRegionsMutex.Lock()
+	previous, ok := servedRegions[address]
+	servedRegions[address] = region
+	servedRegionsMutex.Unlock()
+
+	if ok && previous != region {
+		s3ServedRegion.DeleteLabelValues(address, previous)
+	}
+	s3ServedRegion.WithLabelValues(address, region).Set(1)
+	if configuredRegion == "" {
+		return
+	}
+	if region != configuredRegion {
+		s3RegionMismatch.WithLabelValues(address).Set(1)
+	} else {
+		s3RegionMismatch.WithLabelValues(address).Set(0)
+	}
+}
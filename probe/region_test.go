@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestRegionTransportFlagsMismatch(t *testing.T) {
+	servedRegion := "eu-west-1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if servedRegion != "" {
+			w.Header().Set("X-Amz-Bucket-Region", servedRegion)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	client := http.Client{Transport: newRegionTransport(http.DefaultTransport, address, "X-Amz-Bucket-Region", "eu-west-1")}
+
+	metric := &io_prometheus_client.Metric{}
+	for _, region := range []string{"eu-west-1", "us-east-1", ""} {
+		servedRegion = region
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Errorf("Request failed: %s", err)
+		}
+		resp.Body.Close()
+
+		// Responses without the header keep the last served region
+		expectedMismatch := 0.0
+		if region != "eu-west-1" {
+			expectedMismatch = 1.0
+		}
+		s3RegionMismatch.WithLabelValues(address).Write(metric)
+		if *metric.Gauge.Value != expectedMismatch {
+			t.Errorf("Expected %f for region %q got %f", expectedMismatch, region, *metric.Gauge.Value)
+		}
+	}
+
+	s3ServedRegion.WithLabelValues(address, "us-east-1").Write(metric)
+	if *metric.Gauge.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Gauge.Value)
+	}
+	if s3ServedRegion.DeleteLabelValues(address, "eu-west-1") {
+		t.Errorf("Previously served region should not be exposed anymore")
+	}
+}
@@ -0,0 +1,58 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performRemoveObjectsChecks writes a batch of removeObjectsCount objects then removes them with a
+// multi-object delete. The objects reported as not removed are counted in s3_remove_objects_errors_total
+func (p *Probe) performRemoveObjectsChecks() error {
+	objectSize := int64(p.latencyItemSize)
+	payload, _ := randomPayload(objectSize)
+	objectNames := make([]string, 0, p.removeObjectsCount)
+	// The objects written before a failed write are removed with the batch
+	var putErr error
+	for i := 0; i < p.removeObjectsCount; i++ {
+		objectName := p.randomObjectName()
+		operation := func(ctx context.Context) error {
+			_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+			return err
+		}
+		if putErr = p.mesureOperation("remove_objects_put_object", p.latencyBucketName, operation); putErr != nil {
+			break
+		}
+		objectNames = append(objectNames, objectName)
+	}
+	if len(objectNames) == 0 {
+		return putErr
+	}
+
+	operation := func(ctx context.Context) error {
+		objectsCh := make(chan minio.ObjectInfo, len(objectNames))
+		for _, objectName := range objectNames {
+			objectsCh <- minio.ObjectInfo{Key: objectName}
+		}
+		close(objectsCh)
+		// The error channel is closed once every object was processed, it must be drained
+		failed := 0
+		var lastErr error
+		for removeErr := range p.endpoint.s3Client.RemoveObjects(ctx, p.latencyBucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+			failed++
+			lastErr = removeErr.Err
+		}
+		if failed > 0 {
+			s3RemoveObjectsErrors.WithLabelValues(p.name).Add(float64(failed))
+			p.log(InfoLevel, "Objects not removed by the multi-object delete", Fields{"failed": failed, "total": len(objectNames), "error": lastErr})
+			// The error of the last object is returned unwrapped to keep its S3 error code as reason
+			return lastErr
+		}
+		return nil
+	}
+	if err := p.mesureOperation("remove_objects", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	return putErr
+}
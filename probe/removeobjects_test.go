@@ -0,0 +1,69 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// partialRemoveS3Client mimics a multi-object delete failing on every object
+type partialRemoveS3Client struct {
+	*MemoryS3Client
+}
+
+func (c *partialRemoveS3Client) RemoveObjects(ctx context.Context, bucketName string, objectsCh <-chan minio.ObjectInfo, opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	errorCh := make(chan minio.RemoveObjectError)
+	go func() {
+		defer close(errorCh)
+		for object := range objectsCh {
+			errorCh <- minio.RemoveObjectError{ObjectName: object.Key, Err: minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}}
+		}
+	}()
+	return errorCh
+}
+
+func TestPerformRemoveObjectsCheckOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("remove-objects")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Fatalf("Latency bucket preparation failed: %s", err)
+	}
+	if err := probe.performRemoveObjectsChecks(); err != nil {
+		t.Errorf("Remove objects check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("remove_objects", "remove-objects", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful remove_objects got %f", *metric.Counter.Value)
+	}
+	objects := 0
+	for range probe.endpoint.s3Client.ListObjects(context.Background(), probe.latencyBucketName, minio.ListObjectsOptions{}) {
+		objects++
+	}
+	if objects != 0 {
+		t.Errorf("Expected every object to be removed, %d left", objects)
+	}
+}
+
+func TestRemoveObjectsCheckCountsObjectErrors(t *testing.T) {
+	probe := getMemoryTestProbe("remove-objects-errors")
+	probe.endpoint.s3Client = &partialRemoveS3Client{NewMemoryS3Client()}
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Fatalf("Latency bucket preparation failed: %s", err)
+	}
+	if err := probe.performRemoveObjectsChecks(); err == nil {
+		t.Errorf("Remove objects check should fail when objects are not removed")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3RemoveObjectsErrors.WithLabelValues("remove-objects-errors").Write(metric)
+	if *metric.Counter.Value != float64(probe.removeObjectsCount) {
+		t.Errorf("Expected %d object errors got %f", probe.removeObjectsCount, *metric.Counter.Value)
+	}
+	s3RequestErrors.WithLabelValues("remove_objects", "remove-objects-errors", probe.latencyBucketName, "AccessDenied").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 AccessDenied error got %f", *metric.Counter.Value)
+	}
+}
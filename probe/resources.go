@@ -0,0 +1,91 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const readBufferSize = 32 * 1024
+
+// readBufferPool holds the buffers used to read object bodies, shared by every probe
+var readBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, readBufferSize)
+		return &buffer
+	},
+}
+
+func getReadBuffer() *[]byte {
+	probeBuffersInUse.Inc()
+	return readBufferPool.Get().(*[]byte)
+}
+
+func putReadBuffer(buffer *[]byte) {
+	readBufferPool.Put(buffer)
+	probeBuffersInUse.Dec()
+}
+
+// spawnCheck runs the check in its own goroutine and keeps track of the running checks
+func (p *Probe) spawnCheck(check func() error) {
+	probeActiveChecks.WithLabelValues(p.name).Inc()
+	p.checks.Add(1)
+	go func() {
+		defer p.checks.Done()
+		defer probeActiveChecks.WithLabelValues(p.name).Dec()
+		check()
+	}()
+}
+
+// spawnCycle spawns the checks of a probe cycle and records the duration of the
+// cycle once all of them are done
+func (p *Probe) spawnCycle(checks []func() error) {
+	start := time.Now()
+	var cycle sync.WaitGroup
+	for _, check := range checks {
+		check := check
+		cycle.Add(1)
+		p.spawnCheck(func() error {
+			defer cycle.Done()
+			return check()
+		})
+	}
+	p.checks.Add(1)
+	go func() {
+		defer p.checks.Done()
+		cycle.Wait()
+		s3ProbeCycleDuration.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+		s3ProbeCycles.WithLabelValues(p.name).Inc()
+	}()
+}
+
+// countedConn decrements the open connections gauge when the connection is closed
+type countedConn struct {
+	net.Conn
+	gauge     prometheus.Gauge
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(c.gauge.Dec)
+	return c.Conn.Close()
+}
+
+// countConnections wraps the dialer of the transport to keep track of the connections
+// it opens to the given address
+func countConnections(transport *http.Transport, address string) {
+	gauge := probeOpenConnections.WithLabelValues(address)
+	dialContext := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		gauge.Inc()
+		return &countedConn{Conn: conn, gauge: gauge}, nil
+	}
+}
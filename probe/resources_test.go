@@ -0,0 +1,124 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/config"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestSpawnCheckTracksActiveChecks(t *testing.T) {
+	p := Probe{name: "spawn-test", checks: &sync.WaitGroup{}}
+	release := make(chan struct{})
+	done := make(chan struct{})
+	p.spawnCheck(func() error {
+		<-release
+		return nil
+	})
+
+	metric := &io_prometheus_client.Metric{}
+	probeActiveChecks.WithLabelValues("spawn-test").Write(metric)
+	if *metric.Gauge.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Gauge.Value)
+	}
+
+	close(release)
+	go func() {
+		// Wait returns once every spawned check is done
+		p.checks.Wait()
+		for {
+			probeActiveChecks.WithLabelValues("spawn-test").Write(metric)
+			if *metric.Gauge.Value == 0.0 {
+				close(done)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Active checks gauge was not decremented")
+	}
+}
+
+func TestCountingTransportTracksOpenConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	cfg := config.GetTestConfig()
+	transport, err := newTransport(address, false, &cfg)
+	if err != nil {
+		t.Errorf("Transport creation failed: %s", err)
+	}
+	client := http.Client{Transport: transport}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Errorf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+
+	metric := &io_prometheus_client.Metric{}
+	probeOpenConnections.WithLabelValues(address).Write(metric)
+	if *metric.Gauge.Value != 1.0 {
+		t.Errorf("Expected 1.0 got %f", *metric.Gauge.Value)
+	}
+
+	transport.CloseIdleConnections()
+	probeOpenConnections.WithLabelValues(address).Write(metric)
+	if *metric.Gauge.Value != 0.0 {
+		t.Errorf("Expected 0.0 got %f", *metric.Gauge.Value)
+	}
+}
+
+func TestReadBufferPoolTracksBuffersInUse(t *testing.T) {
+	metric := &io_prometheus_client.Metric{}
+	probeBuffersInUse.Write(metric)
+	before := *metric.Gauge.Value
+
+	buffer := getReadBuffer()
+	if len(*buffer) != readBufferSize {
+		t.Errorf("Expected a %d bytes buffer got %d", readBufferSize, len(*buffer))
+	}
+	probeBuffersInUse.Write(metric)
+	if *metric.Gauge.Value != before+1 {
+		t.Errorf("Expected %f got %f", before+1, *metric.Gauge.Value)
+	}
+
+	putReadBuffer(buffer)
+	probeBuffersInUse.Write(metric)
+	if *metric.Gauge.Value != before {
+		t.Errorf("Expected %f got %f", before, *metric.Gauge.Value)
+	}
+}
+
+func TestSpawnCycleRecordsCycleDuration(t *testing.T) {
+	p := Probe{name: "cycle-test", checks: &sync.WaitGroup{}}
+	p.spawnCycle([]func() error{
+		func() error { return nil },
+		func() error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+	})
+	p.checks.Wait()
+
+	metric := &io_prometheus_client.Metric{}
+	s3ProbeCycles.WithLabelValues("cycle-test").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 cycle got %f", *metric.Counter.Value)
+	}
+	s3ProbeCycleDuration.WithLabelValues("cycle-test").(prometheus.Metric).Write(metric)
+	if *metric.Histogram.SampleCount != 1 || *metric.Histogram.SampleSum < 0.02 {
+		t.Errorf("Expected 1 cycle of at least 20ms got %d cycles lasting %fs", *metric.Histogram.SampleCount, *metric.Histogram.SampleSum)
+	}
+}
@@ -0,0 +1,112 @@
+package probe
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRetryAfter caps the wait requested by an endpoint so a bogus header can't stall the probe
+const maxRetryAfter = 5 * time.Minute
+
+// retryAfterGate holds the requests sent to an endpoint until the time it asked
+// the clients to wait for with a Retry-After header
+type retryAfterGate struct {
+	mutex sync.Mutex
+	until time.Time
+}
+
+var retryAfterGatesMutex sync.Mutex
+var retryAfterGates = map[string]*retryAfterGate{}
+
+// getRetryAfterGate returns the gate of the endpoint address, shared by every client of the endpoint
+func getRetryAfterGate(address string) *retryAfterGate {
+	retryAfterGatesMutex.Lock()
+	defer retryAfterGatesMutex.Unlock()
+	gate, ok := retryAfterGates[address]
+	if !ok {
+		gate = &retryAfterGate{}
+		retryAfterGates[address] = gate
+	}
+	return gate
+}
+
+// delay returns how long requests must still wait
+func (g *retryAfterGate) delay() time.Duration {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return time.Until(g.until)
+}
+
+// active returns true while the endpoint asked the clients to wait
+func (g *retryAfterGate) active() bool {
+	return g.delay() > 0
+}
+
+func (g *retryAfterGate) hold(delay time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	until := time.Now().Add(delay)
+	if until.After(g.until) {
+		g.until = until
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as an HTTP date
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		delay = date.Sub(now)
+	} else {
+		return 0, false
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay, true
+}
+
+// retryAfterTransport honors the Retry-After header of throttled responses: every request
+// sent to the endpoint, retries included, waits for the duration asked by the endpoint
+type retryAfterTransport struct {
+	http.RoundTripper
+	address string
+	gate    *retryAfterGate
+}
+
+func newRetryAfterTransport(transport http.RoundTripper, address string) *retryAfterTransport {
+	return &retryAfterTransport{RoundTripper: transport, address: address, gate: getRetryAfterGate(address)}
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := t.gate.delay(); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			s3RetryAfterWait.WithLabelValues(t.address).Observe(delay.Seconds())
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			t.gate.hold(delay)
+		}
+	}
+	return resp, nil
+}
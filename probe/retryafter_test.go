@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+	delay, ok := parseRetryAfter("2", now)
+	if !ok || delay != 2*time.Second {
+		t.Errorf("Expected 2s got %s", delay)
+	}
+	delay, ok = parseRetryAfter(now.Add(10*time.Second).UTC().Format(http.TimeFormat), now)
+	if !ok || delay < 9*time.Second || delay > 10*time.Second {
+		t.Errorf("Expected about 10s got %s", delay)
+	}
+	delay, ok = parseRetryAfter("86400", now)
+	if !ok || delay != maxRetryAfter {
+		t.Errorf("Expected %s got %s", maxRetryAfter, delay)
+	}
+	if _, ok = parseRetryAfter("soon", now); ok {
+		t.Errorf("Invalid Retry-After header should be ignored")
+	}
+	if _, ok = parseRetryAfter("", now); ok {
+		t.Errorf("Missing Retry-After header should be ignored")
+	}
+}
+
+func TestRetryAfterTransportHoldsRequests(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	client := http.Client{Transport: newRetryAfterTransport(http.DefaultTransport, address)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Errorf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if !getRetryAfterGate(address).active() {
+		t.Errorf("Retry-After should hold the next requests")
+	}
+
+	start := time.Now()
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Errorf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if time.Since(start) < 900*time.Millisecond {
+		t.Errorf("Request was sent without waiting for the Retry-After delay")
+	}
+}
@@ -0,0 +1,116 @@
+package probe
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+const statReferenceObjectSize = 1
+
+// performLargeStatChecks compares the StatObject latency on a large object of the latency bucket
+// with the one on a tiny object: a HEAD is a metadata-only operation, its latency shouldn't depend
+// on the size of the object. Both objects are stated largeStatSamples times and their median
+// latencies are compared, so that a single slow request doesn't look like a size dependency
+func (p *Probe) performLargeStatChecks() error {
+	if err := p.prepareLargeStatObject(); err != nil {
+		return err
+	}
+
+	objectName := p.randomObjectName()
+	objectData, _ := randomObject(statReferenceObjectSize)
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, statReferenceObjectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("stat_reference_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer func() {
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+		}
+		p.mesureOperation("stat_reference_remove_object", p.latencyBucketName, operation)
+	}()
+
+	largeLatencies := make([]time.Duration, 0, p.largeStatSamples)
+	smallLatencies := make([]time.Duration, 0, p.largeStatSamples)
+	for i := 0; i < p.largeStatSamples; i++ {
+		latency, err := p.measureStat("stat_large_object", p.largeStatObject)
+		if err != nil {
+			return err
+		}
+		largeLatencies = append(largeLatencies, latency)
+
+		latency, err = p.measureStat("stat_small_object", objectName)
+		if err != nil {
+			return err
+		}
+		smallLatencies = append(smallLatencies, latency)
+	}
+	largeLatency := medianDuration(largeLatencies)
+	smallLatency := medianDuration(smallLatencies)
+	if smallLatency == 0 {
+		// Without a measurable reference latency the ratio is meaningless
+		p.log(DebugLevel, "StatObject reference latency is zero, skipping the comparison", Fields{"object": objectName})
+		return nil
+	}
+
+	ratio := largeLatency.Seconds() / smallLatency.Seconds()
+	s3StatSizeLatencyRatio.WithLabelValues(p.name).Set(ratio)
+	if ratio > p.largeStatRatio {
+		p.log(WarnLevel, "StatObject latency depends on the object size", Fields{"object": p.largeStatObject, "size": p.largeStatSize,
+			"latency": largeLatency, "reference_size": statReferenceObjectSize, "reference_latency": smallLatency, "samples": p.largeStatSamples})
+		s3StatSizeDependentCounter.WithLabelValues(p.name).Inc()
+	}
+	return nil
+}
+
+// prepareLargeStatObject writes the large object in the latency bucket when it is missing (e.g.
+// on the first check or once expired by the bucket lifecycle) or doesn't have the configured size
+func (p *Probe) prepareLargeStatObject() error {
+	ctx, cancel := context.WithTimeout(p.ctx, p.latencyTimeout)
+	info, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, p.largeStatObject, minio.StatObjectOptions{})
+	cancel()
+	if err == nil && info.Size == p.largeStatSize {
+		return nil
+	}
+	if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return err
+	}
+
+	p.log(InfoLevel, "Writing the large object of the StatObject probe", Fields{"object": p.largeStatObject, "size": p.largeStatSize})
+	operation := func(ctx context.Context) error {
+		objectData, err := randomObject(p.largeStatSize)
+		if err != nil {
+			return err
+		}
+		_, err = p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, p.largeStatObject, objectData, p.largeStatSize, minio.PutObjectOptions{})
+		return err
+	}
+	return p.mesureOperation("stat_large_put_object", p.latencyBucketName, operation)
+}
+
+// measureStat runs a StatObject on the object of the latency bucket and returns the latency of the request
+func (p *Probe) measureStat(operationName string, objectName string) (time.Duration, error) {
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, objectName, minio.StatObjectOptions{})
+		return err
+	}
+	start := time.Now()
+	err := p.mesureOperation(operationName, p.latencyBucketName, operation)
+	return time.Since(start), err
+}
+
+// medianDuration returns the median of the durations, which must not be empty
+func medianDuration(durations []time.Duration) time.Duration {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+// performTaggingChecks writes an object, sets a known tag set on it and reads the tags back, then
+// removes the object. Tags read back different from the written ones are counted in
+// s3_tagging_mismatch_total, endpoints not supporting tagging fail with the NotImplemented reason
+func (p *Probe) performTaggingChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+	payload, _ := randomPayload(objectSize)
+	// Object names may use characters not allowed in tags, a random value is used instead
+	tagValue, _ := randomHex(8)
+	expectedTags := map[string]string{"probe": "s3-probe", "check": tagValue}
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("tagging_put_object", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+	defer p.removeTaggedObject(objectName)
+
+	operation = func(ctx context.Context) error {
+		objectTags, err := tags.MapToObjectTags(expectedTags)
+		if err != nil {
+			return err
+		}
+		err = p.endpoint.s3Client.PutObjectTagging(ctx, p.latencyBucketName, objectName, objectTags, minio.PutObjectTaggingOptions{})
+		if err != nil && classifyError(err) == "NotImplemented" {
+			p.log(InfoLevel, "Object tagging is not supported by the endpoint", nil)
+		}
+		return err
+	}
+	if err := p.mesureOperation("put_tagging", p.latencyBucketName, operation); err != nil {
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		objectTags, err := p.endpoint.s3Client.GetObjectTagging(ctx, p.latencyBucketName, objectName, minio.GetObjectTaggingOptions{})
+		if err != nil {
+			return err
+		}
+		if readTags := objectTags.ToMap(); !equalTags(expectedTags, readTags) {
+			s3TaggingMismatch.WithLabelValues(p.name).Inc()
+			return fmt.Errorf("Expected tags %v but got %v", expectedTags, readTags)
+		}
+		return nil
+	}
+	return p.mesureOperation("get_tagging", p.latencyBucketName, operation)
+}
+
+func (p *Probe) removeTaggedObject(objectName string) {
+	operation := func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+	}
+	p.mesureOperation("tagging_remove_object", p.latencyBucketName, operation)
+}
+
+func equalTags(expected map[string]string, actual map[string]string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for key, value := range expected {
+		if actualValue, ok := actual[key]; !ok || actualValue != value {
+			return false
+		}
+	}
+	return true
+}
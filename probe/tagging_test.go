@@ -0,0 +1,77 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// taggingS3Client mimics endpoints with a broken or missing tagging support
+type taggingS3Client struct {
+	*MemoryS3Client
+	readTags map[string]string
+}
+
+func (c *taggingS3Client) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error {
+	if c.readTags == nil {
+		return minio.ErrorResponse{StatusCode: 501}
+	}
+	return nil
+}
+
+func (c *taggingS3Client) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+	return tags.MapToObjectTags(c.readTags)
+}
+
+func TestPerformTaggingCheckOnMemoryBackend(t *testing.T) {
+	probe := getMemoryTestProbe("tagging-memory")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Fatalf("Latency bucket preparation failed: %s", err)
+	}
+	if err := probe.performTaggingChecks(); err != nil {
+		t.Errorf("Tagging check failed: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3SuccessCounter.WithLabelValues("get_tagging", "tagging-memory", probe.latencyBucketName).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 successful get_tagging got %f", *metric.Counter.Value)
+	}
+}
+
+func TestTaggingCheckDetectsMismatch(t *testing.T) {
+	probe := getMemoryTestProbe("tagging-mismatch")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Fatalf("Latency bucket preparation failed: %s", err)
+	}
+	probe.endpoint.s3Client = &taggingS3Client{probe.endpoint.s3Client.(*MemoryS3Client), map[string]string{"probe": "other"}}
+	if err := probe.performTaggingChecks(); err == nil {
+		t.Errorf("Tagging check should fail on mismatching tags")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3TaggingMismatch.WithLabelValues("tagging-mismatch").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 tagging mismatch got %f", *metric.Counter.Value)
+	}
+}
+
+func TestTaggingCheckReportsNotImplemented(t *testing.T) {
+	probe := getMemoryTestProbe("tagging-unsupported")
+	if err := probe.prepareLatencyBucket(); err != nil {
+		t.Fatalf("Latency bucket preparation failed: %s", err)
+	}
+	probe.endpoint.s3Client = &taggingS3Client{MemoryS3Client: probe.endpoint.s3Client.(*MemoryS3Client)}
+	if err := probe.performTaggingChecks(); err == nil {
+		t.Errorf("Tagging check should fail on endpoints not supporting tagging")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3RequestErrors.WithLabelValues("put_tagging", "tagging-unsupported", probe.latencyBucketName, "NotImplemented").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 NotImplemented error got %f", *metric.Counter.Value)
+	}
+}
@@ -0,0 +1,38 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+// configureTLS makes the transport trust the configured CA (for endpoints using
+// self-signed certificates) or skip the certificate verification altogether
+func configureTLS(transport *http.Transport, cfg *config.Config) error {
+	if *cfg.CACert == "" && !*cfg.InsecureSkipVerify {
+		return nil
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = *cfg.InsecureSkipVerify
+	if *cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(*cfg.CACert)
+		if err != nil {
+			return err
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return errors.New("No certificate found in " + *cfg.CACert)
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+func TestConfigureTLSTrustsCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	caFile, _ := ioutil.TempFile("", "s3-probe-ca")
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile.Close()
+
+	cfg := config.GetTestConfig()
+	transport, _ := newTransport(address, true, &cfg)
+	client := http.Client{Transport: transport}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("Self-signed certificate should not be trusted by default")
+	}
+
+	caCert := caFile.Name()
+	cfg.CACert = &caCert
+	transport, err := newTransport(address, true, &cfg)
+	if err != nil {
+		t.Fatalf("TLS configuration failed: %s", err)
+	}
+	client = http.Client{Transport: transport}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Errorf("Request failed: %s", err)
+	} else {
+		resp.Body.Close()
+	}
+}
+
+func TestConfigureTLSRejectsInvalidCACert(t *testing.T) {
+	cfg := config.GetTestConfig()
+	caCert := "/nonexistent/ca.pem"
+	cfg.CACert = &caCert
+	if _, err := newTransport("localhost:9000", true, &cfg); err == nil {
+		t.Errorf("TLS configuration should fail with a missing CA file")
+	}
+}
+
+func TestParseEndpointDefaultSecure(t *testing.T) {
+	if address, secure := parseEndpoint("localhost:9000", true); address != "localhost:9000" || !secure {
+		t.Errorf("Endpoints without scheme should use the default, got %s %t", address, secure)
+	}
+	if address, secure := parseEndpoint("http://localhost:9000", true); address != "localhost:9000" || secure {
+		t.Errorf("Explicit http:// scheme should not use TLS, got %s %t", address, secure)
+	}
+	if address, secure := parseEndpoint("https://localhost:9000", false); address != "localhost:9000" || !secure {
+		t.Errorf("Explicit https:// scheme should use TLS, got %s %t", address, secure)
+	}
+}
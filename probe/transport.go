@@ -0,0 +1,38 @@
+package probe
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/criteo/s3-probe/config"
+	minio "github.com/minio/minio-go/v7"
+)
+
+// newTransport creates the transport of the clients of an endpoint: the default minio transport
+// with the configured timeouts, connection pool and TLS settings, counting the connections it opens
+func newTransport(address string, secure bool, cfg *config.Config) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, err
+	}
+	configureTransport(transport, cfg)
+	countConnections(transport, address)
+	if err = configureTLS(transport, cfg); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// configureTransport applies the configured timeouts and connection pool size to the transport.
+// Without keep-alives every request opens a new connection, so the latencies include the
+// TCP (and TLS) handshakes instead of depending on the state of the pooled connections
+func configureTransport(transport *http.Transport, cfg *config.Config) {
+	transport.DialContext = (&net.Dialer{
+		Timeout:   *cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = *cfg.TLSHandshakeTimeout
+	transport.MaxIdleConnsPerHost = *cfg.MaxIdleConnsPerHost
+	transport.DisableKeepAlives = *cfg.DisableKeepAlives
+}
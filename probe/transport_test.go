@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/config"
+)
+
+func TestNewTransportAppliesConfig(t *testing.T) {
+	cfg := config.GetTestConfig()
+	tlsHandshakeTimeout := 3 * time.Second
+	maxIdleConnsPerHost := 4
+	cfg.TLSHandshakeTimeout = &tlsHandshakeTimeout
+	cfg.MaxIdleConnsPerHost = &maxIdleConnsPerHost
+
+	transport, err := newTransport("localhost:9000", true, &cfg)
+	if err != nil {
+		t.Fatalf("Transport creation failed: %s", err)
+	}
+	if transport.TLSHandshakeTimeout != tlsHandshakeTimeout {
+		t.Errorf("Expected a TLS handshake timeout of %s got %s", tlsHandshakeTimeout, transport.TLSHandshakeTimeout)
+	}
+	if transport.MaxIdleConnsPerHost != maxIdleConnsPerHost {
+		t.Errorf("Expected %d idle connections per host got %d", maxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	}
+	if transport.DisableKeepAlives {
+		t.Errorf("Keep-alives should be enabled by default")
+	}
+}
+
+func TestTransportWithoutKeepAlivesOpensConnectionPerRequest(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	for _, disableKeepAlives := range []bool{false, true} {
+		atomic.StoreInt32(&connections, 0)
+		cfg := config.GetTestConfig()
+		cfg.DisableKeepAlives = &disableKeepAlives
+		transport, err := newTransport(address, false, &cfg)
+		if err != nil {
+			t.Fatalf("Transport creation failed: %s", err)
+		}
+		client := http.Client{Transport: transport}
+		for i := 0; i < 3; i++ {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Request failed: %s", err)
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		transport.CloseIdleConnections()
+
+		expected := int32(1)
+		if disableKeepAlives {
+			expected = 3
+		}
+		if got := atomic.LoadInt32(&connections); got != expected {
+			t.Errorf("Expected %d connections with keep-alives disabled=%t got %d", expected, disableKeepAlives, got)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"context"
+	"sync"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// BucketUsage describes the content of a bucket
+type BucketUsage struct {
+	Objects int64
+	Bytes   int64
+}
+
+// UsageFetcher returns the usage of a bucket. There is no standard S3 API for it so
+// fetchers are mostly vendor specific (admin APIs, extensions...)
+type UsageFetcher func(ctx context.Context, client S3Client, bucketName string) (BucketUsage, error)
+
+var usageFetchersMutex sync.RWMutex
+var usageFetchers = map[string]UsageFetcher{
+	"listing": listingUsageFetcher,
+}
+
+// RegisterUsageFetcher makes a usage fetcher available to the probes under the given name
+func RegisterUsageFetcher(name string, fetcher UsageFetcher) {
+	usageFetchersMutex.Lock()
+	defer usageFetchersMutex.Unlock()
+	usageFetchers[name] = fetcher
+}
+
+func getUsageFetcher(name string) (UsageFetcher, bool) {
+	usageFetchersMutex.RLock()
+	defer usageFetchersMutex.RUnlock()
+	fetcher, ok := usageFetchers[name]
+	return fetcher, ok
+}
+
+// listingUsageFetcher computes the usage by listing the whole bucket, it works on any endpoint
+// but is expensive on large buckets
+func listingUsageFetcher(ctx context.Context, client S3Client, bucketName string) (BucketUsage, error) {
+	usage := BucketUsage{}
+	objectCh := client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true})
+	for object := range objectCh {
+		if object.Err != nil {
+			return usage, object.Err
+		}
+		usage.Objects++
+		usage.Bytes += object.Size
+	}
+	return usage, nil
+}
+
+// performUsageChecks reports the usage of the probe buckets
+func (p *Probe) performUsageChecks() error {
+	for _, bucketName := range []string{p.latencyBucketName, p.durabilityBucketName} {
+		bucketName := bucketName
+		operation := func(ctx context.Context) error {
+			usage, err := p.usageFetcher(ctx, p.endpoint.s3Client, bucketName)
+			if err != nil {
+				return err
+			}
+			s3BucketObjects.WithLabelValues(p.name, bucketName).Set(float64(usage.Objects))
+			s3BucketBytes.WithLabelValues(p.name, bucketName).Set(float64(usage.Bytes))
+			return nil
+		}
+		if err := p.mesureOperation("bucket_usage", bucketName, operation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
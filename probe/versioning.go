@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"context"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+func (p *Probe) prepareVersioningBucket() error {
+	p.log(InfoLevel, "Checking if versioning bucket is present", Fields{"bucket": p.versioningBucketName})
+	exists, errBucketExists := bucketExists(p.endpoint.s3Client, p.versioningBucketName)
+	if errBucketExists != nil {
+		return errBucketExists
+	}
+	if !exists {
+		p.log(InfoLevel, "Preparing versioning bucket", Fields{"bucket": p.versioningBucketName})
+		probeBucketAttempt.WithLabelValues(p.name).Inc()
+
+		_, err := p.makeBucket(p.endpoint.s3Client, p.versioningBucketName, minio.MakeBucketOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.endpoint.s3Client.EnableVersioning(context.Background(), p.versioningBucketName)
+}
+
+// performVersioningChecks deletes an object on a versioned bucket and checks that
+// a delete marker hides the object while its version is kept, then removes every
+// version to leave the bucket clean
+func (p *Probe) performVersioningChecks() error {
+	objectName := p.randomObjectName()
+	objectSize := int64(p.latencyItemSize)
+
+	objectData, _ := randomObject(objectSize)
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.versioningBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("versioned_put_object", p.versioningBucketName, operation); err != nil {
+		return err
+	}
+	defer p.removeObjectVersions(objectName)
+
+	operation = func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveObject(ctx, p.versioningBucketName, objectName, minio.RemoveObjectOptions{})
+	}
+	if err := p.mesureOperation("versioned_remove_object", p.versioningBucketName, operation); err != nil {
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		deleteMarkerFound := false
+		versionFound := false
+		for _, object := range p.listObjectVersions(ctx, objectName) {
+			if object.Err != nil {
+				return object.Err
+			}
+			if object.IsDeleteMarker {
+				deleteMarkerFound = true
+			} else {
+				versionFound = true
+			}
+		}
+		if !deleteMarkerFound {
+			p.log(WarnLevel, "No delete marker found", Fields{"object": objectName})
+			s3VersioningAnomalies.WithLabelValues(p.name, "missing_delete_marker").Inc()
+		}
+		if !versionFound {
+			p.log(WarnLevel, "No version left after delete", Fields{"object": objectName})
+			s3VersioningAnomalies.WithLabelValues(p.name, "missing_version").Inc()
+		}
+		return nil
+	}
+	if err := p.mesureOperation("versioned_list_versions", p.versioningBucketName, operation); err != nil {
+		return err
+	}
+
+	// A GET on a key hidden behind a delete marker must answer NoSuchKey
+	operation = func(ctx context.Context) error {
+		obj, err := p.endpoint.s3Client.GetObject(ctx, p.versioningBucketName, objectName, minio.GetObjectOptions{})
+		if err == nil {
+			defer obj.Close()
+			_, err = obj.Stat()
+		}
+		if err == nil {
+			p.log(WarnLevel, "Object is still readable after delete", Fields{"object": objectName})
+			s3VersioningAnomalies.WithLabelValues(p.name, "readable_after_delete").Inc()
+			return nil
+		}
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			s3VersioningAnomalies.WithLabelValues(p.name, "unexpected_get_error").Inc()
+			return err
+		}
+		return nil
+	}
+	if err := p.mesureOperation("versioned_get_deleted", p.versioningBucketName, operation); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Probe) listObjectVersions(ctx context.Context, objectName string) []minio.ObjectInfo {
+	objects := []minio.ObjectInfo{}
+	objectCh := p.endpoint.s3Client.ListObjects(ctx, p.versioningBucketName, minio.ListObjectsOptions{WithVersions: true, Prefix: objectName})
+	for object := range objectCh {
+		if object.Err == nil && object.Key != objectName {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// removeObjectVersions permanently deletes every version (delete markers included) of the given object
+func (p *Probe) removeObjectVersions(objectName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.latencyTimeout)
+	defer cancel()
+	for _, object := range p.listObjectVersions(ctx, objectName) {
+		if object.Err != nil {
+			p.log(InfoLevel, "Error while listing versions", Fields{"object": objectName, "error": object.Err})
+			return
+		}
+		versionID := object.VersionID
+		operation := func(ctx context.Context) error {
+			return p.endpoint.s3Client.RemoveObject(ctx, p.versioningBucketName, objectName, minio.RemoveObjectOptions{VersionID: versionID})
+		}
+		p.mesureOperation("versioned_remove_version", p.versioningBucketName, operation)
+	}
+}
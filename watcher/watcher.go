@@ -1,7 +1,14 @@
 package watcher
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/criteo/s3-probe/probe"
@@ -12,15 +19,20 @@ import (
 )
 
 type watchedService struct {
-	service   probe.S3Service
-	probeChan chan bool
+	service probe.S3Service
+	probe   *probe.Probe
+	cancel  context.CancelFunc
+	// done is closed once the probe stopped probing
+	done chan struct{}
 }
 
 // Watcher manages the pool of S3 endpoints to monitor
 type Watcher struct {
 	consulClient    probe.ConsulClient
 	cfg             *config.Config
+	mutex           sync.RWMutex
 	watchedServices map[string]watchedService
+	preparing       int32
 }
 
 var serviceDiscoveryErrorCounter = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -42,53 +54,134 @@ func NewWatcher(cfg config.Config) Watcher {
 }
 
 // WatchPools poll consul services with specified tag and create
-// probe gorountines
-func (w *Watcher) WatchPools(interval time.Duration) {
+// probe gorountines until the context is done, then stops all the
+// probes and waits for their running checks before returning
+func (w *Watcher) WatchPools(ctx context.Context, interval time.Duration) {
 	for {
 		log.Printf("Discovering S3 endpoints (interval: %s)", interval)
 		servicesFromConsul := w.getServices()
 		watchedServices := w.getWatchedServices()
 		servicesToAdd, servicesToRemove := w.getServicesToModify(servicesFromConsul, watchedServices)
 		w.flushOldProbes(servicesToRemove)
-		w.createNewProbes(servicesToAdd)
-		time.Sleep(interval)
+		w.createNewProbes(ctx, servicesToAdd)
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping all probes")
+			w.flushOldProbes(w.getWatchedServices())
+			return
+		case <-time.After(interval):
+		}
 	}
+}
 
+// RunOnce discovers the S3 endpoints then runs a single probe cycle on each of them,
+// the returned error reports the endpoints that failed
+func (w *Watcher) RunOnce(ctx context.Context) error {
+	services := w.getServices()
+	if len(services) == 0 {
+		return errors.New("No S3 endpoint discovered")
+	}
+	var failures []string
+	for _, s3service := range services {
+		log.Printf("Probing once: %s, gateway: %t", s3service.Name, s3service.Gateway)
+		p, err := probe.NewProbeFromConsul(s3service, w.cfg)
+		if err == nil {
+			err = p.RunOnce(ctx)
+		}
+		if err != nil {
+			log.Printf("Probing %s failed: %s", s3service.Name, err)
+			failures = append(failures, s3service.Name)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Probing failed for %d/%d endpoints: %s", len(failures), len(services), strings.Join(failures, ", "))
+	}
+	return nil
 }
 
-func (w *Watcher) createNewProbes(servicesToAdd []probe.S3Service) {
+func (w *Watcher) createNewProbes(ctx context.Context, servicesToAdd []probe.S3Service) {
+	// Probes are watched once prepared, the watcher is not ready while preparing them
+	atomic.StoreInt32(&w.preparing, 1)
+	defer atomic.StoreInt32(&w.preparing, 0)
 	for _, s3service := range servicesToAdd {
+		if ctx.Err() != nil {
+			return
+		}
 		log.Printf("Creating new probe for: %s, gateway: %t", s3service.Name, s3service.Gateway)
-		probeChan := make(chan bool)
-
-		p, err := probe.NewProbeFromConsul(s3service, w.cfg, probeChan)
+		p, err := probe.NewProbeFromConsul(s3service, w.cfg)
 		if err != nil {
 			log.Println("Error while creating probe:", err)
 			continue
 		}
 
-		err = p.PrepareProbing()
+		// The service is not watched when the preparation fails: the probe
+		// is created again and its preparation retried on the next discovery
+		err = p.PrepareProbing(ctx)
+		if ctx.Err() != nil {
+			log.Println("Probe preparation interrupted:", s3service.Name)
+			return
+		}
 		if err != nil {
-			log.Println("Error while preparing probe:", err)
-			close(probeChan)
+			log.Println("Error while preparing probe (retrying on next discovery):", err)
 			continue
 		}
 
-		w.watchedServices[s3service.Name] = watchedService{service: s3service, probeChan: probeChan}
-		go p.StartProbing()
+		probeCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		w.mutex.Lock()
+		w.watchedServices[s3service.Name] = watchedService{service: s3service, probe: &p, cancel: cancel, done: done}
+		w.mutex.Unlock()
+		go func() {
+			defer close(done)
+			p.StartProbing(probeCtx)
+		}()
 	}
 }
 
+// flushOldProbes stops the probes of the services and waits for their running checks
 func (w *Watcher) flushOldProbes(servicesToRemove []probe.S3Service) {
+	stopped := []watchedService{}
 	for _, s3service := range servicesToRemove {
 		log.Printf("Removing old probe for: %s", s3service.Name)
+		w.mutex.Lock()
 		ws, ok := w.watchedServices[s3service.Name]
 		if ok {
 			delete(w.watchedServices, s3service.Name)
-			ws.probeChan <- false
-			close(ws.probeChan)
+			ws.cancel()
+			stopped = append(stopped, ws)
+		}
+		w.mutex.Unlock()
+	}
+	// The probes are all cancelled before waiting, so that they stop concurrently
+	for _, ws := range stopped {
+		<-ws.done
+	}
+}
+
+// LivenessHandler reports if all the watched probes are running
+func (w *Watcher) LivenessHandler() http.Handler {
+	return probe.NewHealthHandler(func() bool {
+		return w.allProbes((*probe.Probe).IsAlive)
+	})
+}
+
+// ReadinessHandler reports if no probe is being prepared and all the watched probes are
+// running and done seeding their durability bucket
+func (w *Watcher) ReadinessHandler() http.Handler {
+	return probe.NewHealthHandler(func() bool {
+		return atomic.LoadInt32(&w.preparing) == 0 && w.allProbes((*probe.Probe).IsReady)
+	})
+}
+
+func (w *Watcher) allProbes(check func(*probe.Probe) bool) bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	for _, ws := range w.watchedServices {
+		if !check(ws.probe) {
+			return false
 		}
 	}
+	return true
 }
 
 // getServicesToModify compare services as seen in consul and services that are running in the probe. Every service that
@@ -102,6 +195,8 @@ func (w *Watcher) getServicesToModify(servicesFromConsul []probe.S3Service, watc
 func (w *Watcher) getWatchedServices() []probe.S3Service {
 	currentServices := []probe.S3Service{}
 
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
 	for _, ws := range w.watchedServices {
 		currentServices = append(currentServices, ws.service)
 	}
@@ -118,14 +213,14 @@ func (w *Watcher) getServices() []probe.S3Service {
 
 	results := make([]probe.S3Service, 0)
 	for serviceName, isGateway := range services {
-		endpoint, readEndpoints, err := w.consulClient.GetServiceEndPoints(serviceName, isGateway)
+		endpoint, readEndpoints, edgeEndpoint, err := w.consulClient.GetServiceEndPoints(serviceName, isGateway)
 		if err != nil {
 			serviceDiscoveryErrorCounter.WithLabelValues(serviceName).Inc()
 			log.Printf("Resolving service endpoints failed for %s: %s\n", serviceName, err)
 			continue
 		}
 
-		s := probe.S3Service{Name: serviceName, Endpoint: endpoint, Gateway: isGateway, GatewayReadEnpoints: readEndpoints}
+		s := probe.S3Service{Name: serviceName, Endpoint: endpoint, Gateway: isGateway, GatewayReadEnpoints: readEndpoints, EdgeEndpoint: edgeEndpoint}
 		results = append(results, s)
 	}
 
@@ -1,11 +1,15 @@
 package watcher
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/smartystreets/assertions/assert"
 	"github.com/smartystreets/assertions/should"
@@ -21,6 +25,7 @@ type consulClientMock struct {
 	RegisteredServicesError error
 	ServiceEndPoints        map[string]string
 	ReadEndPoints           map[string][]probe.S3Endpoint
+	EdgeEndPoints           map[string]string
 	ServiceEndPointsError   error
 }
 
@@ -31,11 +36,11 @@ func (cc *consulClientMock) GetAllMatchingRegisteredServices() (map[string]bool,
 	return cc.RegisteredServices, nil
 }
 
-func (cc *consulClientMock) GetServiceEndPoints(serviceName string, isGateway bool) (string, []probe.S3Endpoint, error) {
+func (cc *consulClientMock) GetServiceEndPoints(serviceName string, isGateway bool) (string, []probe.S3Endpoint, string, error) {
 	if cc.ServiceEndPointsError != nil {
-		return "", []probe.S3Endpoint{}, cc.ServiceEndPointsError
+		return "", []probe.S3Endpoint{}, "", cc.ServiceEndPointsError
 	}
-	return cc.ServiceEndPoints[serviceName], cc.ReadEndPoints[serviceName], nil
+	return cc.ServiceEndPoints[serviceName], cc.ReadEndPoints[serviceName], cc.EdgeEndPoints[serviceName], nil
 }
 
 func TestGetServiceFailureToListServices(t *testing.T) {
@@ -93,6 +98,7 @@ func TestGetService(t *testing.T) {
 	consulClient.RegisteredServices = map[string]bool{"myservice": false, "myotherservice": true}
 	consulClient.ServiceEndPoints = map[string]string{"myservice": "127.0.0.1", "myotherservice": "127.0.0.2"}
 	consulClient.ReadEndPoints = map[string][]probe.S3Endpoint{"myotherservice": {probe.S3Endpoint{Name: "10.0.0.1"}, probe.S3Endpoint{Name: "10.0.0.2"}}}
+	consulClient.EdgeEndPoints = map[string]string{"myservice": "edge.local"}
 
 	cfg := config.GetTestConfig()
 	watcher := Watcher{consulClient: consulClient, cfg: &cfg, watchedServices: map[string]watchedService{}}
@@ -103,13 +109,18 @@ func TestGetService(t *testing.T) {
 		t.Errorf("Expected 2 S3Service but got %d", len(services))
 	}
 
-	if services[0].Name != "myservice" || services[0].Endpoint != "127.0.0.1" ||
-		services[0].Gateway != false || len(services[0].GatewayReadEnpoints) != 0 {
+	// Services are discovered in no particular order
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	if services[1].Name != "myservice" || services[1].Endpoint != "127.0.0.1" ||
+		services[1].Gateway != false || len(services[1].GatewayReadEnpoints) != 0 || services[1].EdgeEndpoint != "edge.local" {
 		t.Errorf("myservice don't match expectation")
 	}
 
-	if services[1].Name != "myotherservice" || services[1].Endpoint != "127.0.0.2" ||
-		services[1].Gateway != true || len(services[1].GatewayReadEnpoints) != 2 {
+	if services[0].Name != "myotherservice" || services[0].Endpoint != "127.0.0.2" ||
+		services[0].Gateway != true || len(services[0].GatewayReadEnpoints) != 2 || services[0].EdgeEndpoint != "" {
 		t.Errorf("myotherservice don't match expectation")
 	}
 
@@ -220,15 +231,15 @@ func TestGetServicesToModifyReturnsEmptyWhenNoChange(t *testing.T) {
 }
 
 func TestFlushOldProbesSendStopCommand(t *testing.T) {
-	controlChan := make(chan bool, 1)
+	ctx, cancel := context.WithCancel(context.Background())
 	w := Watcher{
-		watchedServices: map[string]watchedService{"test": {service: probe.S3Service{Name: "test"}, probeChan: controlChan}},
+		watchedServices: map[string]watchedService{"test": {service: probe.S3Service{Name: "test"}, cancel: cancel, done: stoppedOnCancel(ctx)}},
 	}
-	if len(controlChan) != 0 {
-		t.Errorf("Chan not empty by default")
+	if ctx.Err() != nil {
+		t.Errorf("Context done by default")
 	}
 	w.flushOldProbes(s3ServicesFromStrings([]string{"test"}))
-	if len(controlChan) != 1 {
+	if ctx.Err() == nil {
 		t.Errorf("Stop command not received")
 	}
 	result := assert.So(w.watchedServices, should.NotContainKey, "test")
@@ -236,3 +247,56 @@ func TestFlushOldProbesSendStopCommand(t *testing.T) {
 		t.Errorf("The assertion failed: %s", result)
 	}
 }
+
+func TestReadinessHandlerWaitsForPreparingProbes(t *testing.T) {
+	w := Watcher{watchedServices: map[string]watchedService{}}
+	recorder := httptest.NewRecorder()
+	w.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/ready", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Watcher without probes should be ready got %d", recorder.Code)
+	}
+
+	w.preparing = 1
+	recorder = httptest.NewRecorder()
+	w.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/ready", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Watcher should not be ready while preparing probes got %d", recorder.Code)
+	}
+}
+
+// stoppedOnCancel returns the done channel of a fake probe stopping once the context is done
+func stoppedOnCancel(ctx context.Context) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	}()
+	return done
+}
+
+func TestWatchPoolsStopsProbesWhenDone(t *testing.T) {
+	service := probe.S3Service{Name: "test", Endpoint: "127.0.0.1", GatewayReadEnpoints: []probe.S3Endpoint{}}
+	consulClient := &consulClientMock{
+		RegisteredServices: map[string]bool{"test": false},
+		ServiceEndPoints:   map[string]string{"test": "127.0.0.1"},
+	}
+	cfg := config.GetTestConfig()
+	probeCtx, cancelProbe := context.WithCancel(context.Background())
+	done := stoppedOnCancel(probeCtx)
+	w := Watcher{consulClient: consulClient, cfg: &cfg,
+		watchedServices: map[string]watchedService{"test": {service: service, cancel: cancelProbe, done: done}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.WatchPools(ctx, time.Hour)
+
+	select {
+	case <-done:
+	default:
+		t.Errorf("WatchPools should wait for the probes to stop")
+	}
+	if len(w.watchedServices) != 0 {
+		t.Errorf("Expected no watched service got %d", len(w.watchedServices))
+	}
+}